@@ -8,15 +8,22 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
 
+	"lunar-lander/internal/db"
 	"lunar-lander/internal/server"
 	"lunar-lander/internal/sugardb"
 	"lunar-lander/internal/watch"
 )
 
+// reloadGracePeriod is how long a superseded Runtime's Lua states are kept
+// alive after a hot reload, so requests that grabbed it from ServeHTTP just
+// before the swap get to finish instead of running against a closed engine.
+const reloadGracePeriod = 5 * time.Second
+
 type runtimeState struct {
 	mu      sync.RWMutex
 	runtime *server.Runtime
@@ -36,22 +43,63 @@ func (s *runtimeState) Swap(next *server.Runtime) {
 	s.mu.Unlock()
 
 	if old != nil {
-		old.Engine.Close()
+		time.AfterFunc(reloadGracePeriod, old.Engine.Close)
 	}
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "cmd" {
+		os.Exit(runCLICommand(os.Args[2:]))
+	}
+
 	var scriptPath string
 	var addr string
 	var watchEnabled bool
+	var dbPath string
+	var logFormat string
+	var logLevel string
+	var luaPoolSize int
+	var httpTimeout time.Duration
+	var httpMaxRedirects int
+	var httpProxy string
+	var handlerTimeout time.Duration
+	var templatesDir string
+	var scriptsDir string
 	flag.StringVar(&scriptPath, "script", "app.lua", "path to Lua script")
 	flag.StringVar(&addr, "addr", ":8080", "address to listen on")
 	flag.BoolVar(&watchEnabled, "watch", false, "watch the script path for changes")
+	flag.StringVar(&scriptsDir, "scripts-dir", "", "for multi-file scripts, watch every .lua file under this directory instead of just -script (requires -watch)")
+	flag.StringVar(&dbPath, "db", "lunar.json", "path to persisted collection storage (empty for memory-only)")
+	flag.StringVar(&logFormat, "log-format", "json", "request log format: json|console")
+	flag.StringVar(&logLevel, "log-level", "info", "minimum request log level")
+	flag.IntVar(&luaPoolSize, "lua-pool-size", 8, "number of pooled Lua states serving rest.* handlers concurrently")
+	flag.DurationVar(&httpTimeout, "http-timeout", 30*time.Second, "timeout for outbound http.* calls made from Lua")
+	flag.IntVar(&httpMaxRedirects, "http-max-redirects", 10, "max redirects followed by outbound http.* calls")
+	flag.StringVar(&httpProxy, "http-proxy", "", "proxy URL used for outbound http.* calls (empty to disable)")
+	flag.DurationVar(&handlerTimeout, "handler-timeout", 30*time.Second, "maximum time a single rest.* handler invocation may run before it is cancelled")
+	flag.StringVar(&templatesDir, "templates-dir", "", "directory of html/template files to make available via the render module (empty disables it)")
 	flag.Parse()
 
+	server.ConfigureLogging(logFormat, logLevel)
+
+	engineOpts := server.EngineOptions{
+		LuaPoolSize:      luaPoolSize,
+		HTTPTimeout:      httpTimeout,
+		HTTPMaxRedirects: httpMaxRedirects,
+		HTTPProxy:        httpProxy,
+		HandlerTimeout:   handlerTimeout,
+		TemplatesDir:     templatesDir,
+	}
+
 	state := &runtimeState{}
 	store := sugardb.NewStore()
-	initial, err := server.BuildRuntime(scriptPath, store)
+	defer store.Close()
+	records, err := db.Open(dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to initialize database: %v\n", err)
+		os.Exit(1)
+	}
+	initial, err := server.BuildRuntime(scriptPath, store, records, engineOpts)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "failed to start: %v\n", err)
 		os.Exit(1)
@@ -62,15 +110,22 @@ func main() {
 	defer stop()
 
 	if watchEnabled {
-		watcher := watch.NewScriptWatcher(scriptPath, func() {
+		onChange := func() {
 			log.Printf("script change detected: reloading %s", scriptPath)
-			next, err := server.BuildRuntime(scriptPath, store)
+			next, err := server.BuildRuntime(scriptPath, store, records, engineOpts)
 			if err != nil {
 				log.Printf("reload failed: %v", err)
 				return
 			}
 			state.Swap(next)
-		})
+		}
+
+		var watcher *watch.ScriptWatcher
+		if scriptsDir != "" {
+			watcher = watch.NewDirScriptWatcher(scriptsDir, onChange)
+		} else {
+			watcher = watch.NewScriptWatcher(scriptPath, onChange)
+		}
 		go func() {
 			if err := watcher.Run(ctx); err != nil {
 				log.Printf("watcher stopped: %v", err)
@@ -97,3 +152,62 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// runCLICommand loads app.lua the same way the HTTP server does, then
+// dispatches a Lua-registered `cmd` subcommand instead of starting gin.
+// Usage: lunar-lander cmd <name> [--script=app.lua] [--db=lunar.json] [--flag=value ...]
+func runCLICommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: lunar-lander cmd <name> [--flag=value ...]")
+		return 1
+	}
+	name := args[0]
+
+	scriptPath := "app.lua"
+	dbPath := "lunar.json"
+	flagArgs := make([]string, 0, len(args)-1)
+	for _, arg := range args[1:] {
+		switch {
+		case strings.HasPrefix(arg, "--script="):
+			scriptPath = strings.TrimPrefix(arg, "--script=")
+		case strings.HasPrefix(arg, "--db="):
+			dbPath = strings.TrimPrefix(arg, "--db=")
+		default:
+			flagArgs = append(flagArgs, arg)
+		}
+	}
+
+	store := sugardb.NewStore()
+	defer store.Close()
+	records, err := db.Open(dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to initialize database: %v\n", err)
+		return 1
+	}
+	// A CLI invocation only ever runs one command, so there's no benefit to
+	// building a full rest.* handler pool here; outbound http.* calls still
+	// get sane defaults.
+	runtime, err := server.BuildRuntime(scriptPath, store, records, server.EngineOptions{
+		LuaPoolSize:      1,
+		HTTPTimeout:      30 * time.Second,
+		HTTPMaxRedirects: 10,
+		HandlerTimeout:   30 * time.Second,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load script: %v\n", err)
+		return 1
+	}
+	defer runtime.Engine.Close()
+
+	code, output, err := runtime.Engine.DispatchCommand(name, flagArgs)
+	if output != "" {
+		fmt.Print(output)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		if code == 0 {
+			code = 1
+		}
+	}
+	return code
+}
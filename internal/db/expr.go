@@ -0,0 +1,458 @@
+package db
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Expr is a parsed query predicate, as accepted by Store.QueryExpr and its
+// Update/Delete variants: comparisons (==, !=, <, <=, >, >=), boolean
+// operators (&&, ||, !), parentheses, string helpers (field.startsWith(...),
+// field.contains(...), field.endsWith(...)) and :name parameter
+// placeholders resolved against the params map passed at query time.
+type Expr struct {
+	root exprNode
+}
+
+// ParseExpr compiles an infix query expression, e.g.
+// `age >= :min && name.startsWith(:p)`.
+func ParseExpr(input string) (*Expr, error) {
+	tokens, err := lexExpr(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokEOF {
+		return nil, fmt.Errorf("unexpected trailing input near %q", p.peek().text)
+	}
+	return &Expr{root: root}, nil
+}
+
+// Eval reports whether record satisfies the expression, substituting params
+// for any :name placeholders it contains.
+func (x *Expr) Eval(record Record, params map[string]any) (bool, error) {
+	return x.root.eval(record, params)
+}
+
+type exprNode interface {
+	eval(record Record, params map[string]any) (bool, error)
+}
+
+type orNode struct{ left, right exprNode }
+
+func (n *orNode) eval(record Record, params map[string]any) (bool, error) {
+	left, err := n.left.eval(record, params)
+	if err != nil {
+		return false, err
+	}
+	if left {
+		return true, nil
+	}
+	return n.right.eval(record, params)
+}
+
+type andNode struct{ left, right exprNode }
+
+func (n *andNode) eval(record Record, params map[string]any) (bool, error) {
+	left, err := n.left.eval(record, params)
+	if err != nil || !left {
+		return false, err
+	}
+	return n.right.eval(record, params)
+}
+
+type notNode struct{ inner exprNode }
+
+func (n *notNode) eval(record Record, params map[string]any) (bool, error) {
+	value, err := n.inner.eval(record, params)
+	return !value, err
+}
+
+type compareNode struct {
+	field string
+	op    string
+	value valueExpr
+}
+
+func (n *compareNode) eval(record Record, params map[string]any) (bool, error) {
+	fieldValue := lookupField(record, n.field)
+	want, err := n.value.resolve(params)
+	if err != nil {
+		return false, err
+	}
+	switch n.op {
+	case "==":
+		return valuesEqual(fieldValue, want), nil
+	case "!=":
+		return !valuesEqual(fieldValue, want), nil
+	default:
+		left, leftOK := numberValue(fieldValue)
+		right, rightOK := numberValue(want)
+		if !leftOK || !rightOK {
+			return false, fmt.Errorf("field %q: cannot compare non-numeric values with %q", n.field, n.op)
+		}
+		switch n.op {
+		case "<":
+			return left < right, nil
+		case "<=":
+			return left <= right, nil
+		case ">":
+			return left > right, nil
+		case ">=":
+			return left >= right, nil
+		default:
+			return false, fmt.Errorf("unknown operator %q", n.op)
+		}
+	}
+}
+
+type callNode struct {
+	field  string
+	method string
+	arg    valueExpr
+}
+
+func (n *callNode) eval(record Record, params map[string]any) (bool, error) {
+	fieldValue, ok := lookupField(record, n.field).(string)
+	if !ok {
+		return false, nil
+	}
+	argValue, err := n.arg.resolve(params)
+	if err != nil {
+		return false, err
+	}
+	arg, ok := argValue.(string)
+	if !ok {
+		return false, fmt.Errorf("%s.%s: argument must be a string", n.field, n.method)
+	}
+	switch n.method {
+	case "startsWith":
+		return strings.HasPrefix(fieldValue, arg), nil
+	case "endsWith":
+		return strings.HasSuffix(fieldValue, arg), nil
+	case "contains":
+		return strings.Contains(fieldValue, arg), nil
+	default:
+		return false, fmt.Errorf("unknown function %q", n.method)
+	}
+}
+
+// valueExpr is the right-hand side of a comparison: either a literal or a
+// :name parameter reference.
+type valueExpr interface {
+	resolve(params map[string]any) (any, error)
+}
+
+type literalExpr struct{ value any }
+
+func (l *literalExpr) resolve(map[string]any) (any, error) { return l.value, nil }
+
+type paramExpr struct{ name string }
+
+func (p *paramExpr) resolve(params map[string]any) (any, error) {
+	value, ok := params[p.name]
+	if !ok {
+		return nil, fmt.Errorf("missing parameter %q", p.name)
+	}
+	return value, nil
+}
+
+// lookupField walks a dotted path (e.g. "address.city") through a record,
+// descending into nested maps.
+func lookupField(record Record, path string) any {
+	var current any = record
+	for _, part := range strings.Split(path, ".") {
+		switch typed := current.(type) {
+		case Record:
+			current = typed[part]
+		case map[string]any:
+			current = typed[part]
+		default:
+			return nil
+		}
+	}
+	return current
+}
+
+// --- lexer ---
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokParam
+	tokAnd
+	tokOr
+	tokNot
+	tokEq
+	tokNeq
+	tokLt
+	tokLte
+	tokGt
+	tokGte
+	tokLParen
+	tokRParen
+)
+
+type exprToken struct {
+	kind tokenKind
+	text string
+}
+
+func lexExpr(input string) ([]exprToken, error) {
+	var tokens []exprToken
+	i, n := 0, len(input)
+	for i < n {
+		c := input[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, exprToken{tokLParen, "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, exprToken{tokRParen, ")"})
+			i++
+		case c == '!' && i+1 < n && input[i+1] == '=':
+			tokens = append(tokens, exprToken{tokNeq, "!="})
+			i += 2
+		case c == '!':
+			tokens = append(tokens, exprToken{tokNot, "!"})
+			i++
+		case c == '=' && i+1 < n && input[i+1] == '=':
+			tokens = append(tokens, exprToken{tokEq, "=="})
+			i += 2
+		case c == '<' && i+1 < n && input[i+1] == '=':
+			tokens = append(tokens, exprToken{tokLte, "<="})
+			i += 2
+		case c == '<':
+			tokens = append(tokens, exprToken{tokLt, "<"})
+			i++
+		case c == '>' && i+1 < n && input[i+1] == '=':
+			tokens = append(tokens, exprToken{tokGte, ">="})
+			i += 2
+		case c == '>':
+			tokens = append(tokens, exprToken{tokGt, ">"})
+			i++
+		case c == '&' && i+1 < n && input[i+1] == '&':
+			tokens = append(tokens, exprToken{tokAnd, "&&"})
+			i += 2
+		case c == '|' && i+1 < n && input[i+1] == '|':
+			tokens = append(tokens, exprToken{tokOr, "||"})
+			i += 2
+		case c == ':':
+			j := i + 1
+			for j < n && isIdentChar(input[j]) {
+				j++
+			}
+			if j == i+1 {
+				return nil, fmt.Errorf("expected parameter name at offset %d", i)
+			}
+			tokens = append(tokens, exprToken{tokParam, input[i+1 : j]})
+			i = j
+		case c == '"' || c == '\'':
+			quote := c
+			j := i + 1
+			for j < n && input[j] != quote {
+				j++
+			}
+			if j >= n {
+				return nil, fmt.Errorf("unterminated string literal at offset %d", i)
+			}
+			tokens = append(tokens, exprToken{tokString, input[i+1 : j]})
+			i = j + 1
+		case c >= '0' && c <= '9':
+			j := i
+			for j < n && (input[j] >= '0' && input[j] <= '9' || input[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, exprToken{tokNumber, input[i:j]})
+			i = j
+		case isIdentStart(c):
+			j := i
+			for j < n && isIdentChar(input[j]) {
+				j++
+			}
+			tokens = append(tokens, exprToken{tokIdent, input[i:j]})
+			i = j
+		default:
+			return nil, fmt.Errorf("unexpected character %q at offset %d", c, i)
+		}
+	}
+	tokens = append(tokens, exprToken{tokEOF, ""})
+	return tokens, nil
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || (c >= '0' && c <= '9') || c == '.'
+}
+
+// --- recursive-descent parser ---
+
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+}
+
+func (p *exprParser) peek() exprToken { return p.tokens[p.pos] }
+
+func (p *exprParser) next() exprToken {
+	t := p.tokens[p.pos]
+	p.pos++
+	return t
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokOr {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &orNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokAnd {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &andNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if p.peek().kind == tokNot {
+		p.next()
+		inner, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{inner: inner}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	if p.peek().kind == tokLParen {
+		p.next()
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek().kind != tokRParen {
+			return nil, fmt.Errorf("expected ')' near %q", p.peek().text)
+		}
+		p.next()
+		return inner, nil
+	}
+
+	if p.peek().kind != tokIdent {
+		return nil, fmt.Errorf("expected field name, got %q", p.peek().text)
+	}
+	field := p.next()
+
+	if p.peek().kind == tokLParen {
+		p.next()
+		var arg valueExpr
+		if p.peek().kind != tokRParen {
+			var err error
+			arg, err = p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+		}
+		if p.peek().kind != tokRParen {
+			return nil, fmt.Errorf("expected ')' near %q", p.peek().text)
+		}
+		p.next()
+
+		dot := strings.LastIndex(field.text, ".")
+		if dot < 0 {
+			return nil, fmt.Errorf("expected field.method(...), got %q", field.text)
+		}
+		return &callNode{field: field.text[:dot], method: field.text[dot+1:], arg: arg}, nil
+	}
+
+	op, err := p.parseCompareOp()
+	if err != nil {
+		return nil, err
+	}
+	value, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	return &compareNode{field: field.text, op: op, value: value}, nil
+}
+
+func (p *exprParser) parseCompareOp() (string, error) {
+	t := p.next()
+	switch t.kind {
+	case tokEq:
+		return "==", nil
+	case tokNeq:
+		return "!=", nil
+	case tokLt:
+		return "<", nil
+	case tokLte:
+		return "<=", nil
+	case tokGt:
+		return ">", nil
+	case tokGte:
+		return ">=", nil
+	default:
+		return "", fmt.Errorf("expected comparison operator, got %q", t.text)
+	}
+}
+
+func (p *exprParser) parseOperand() (valueExpr, error) {
+	t := p.next()
+	switch t.kind {
+	case tokParam:
+		return &paramExpr{name: t.text}, nil
+	case tokString:
+		return &literalExpr{value: t.text}, nil
+	case tokNumber:
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", t.text)
+		}
+		return &literalExpr{value: f}, nil
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return &literalExpr{value: true}, nil
+		case "false":
+			return &literalExpr{value: false}, nil
+		default:
+			return nil, fmt.Errorf("unexpected identifier %q in value position", t.text)
+		}
+	default:
+		return nil, fmt.Errorf("unexpected token %q in value position", t.text)
+	}
+}
@@ -64,6 +64,101 @@ func (s *Store) Query(collection string, criteria Record) ([]Record, error) {
 	return result, nil
 }
 
+// QueryExpr filters collection with an infix expression (see ParseExpr)
+// instead of the equality-only criteria Query accepts.
+func (s *Store) QueryExpr(collection, expr string, params map[string]any) ([]Record, error) {
+	if collection == "" {
+		return nil, errors.New("collection is required")
+	}
+	parsed, err := ParseExpr(expr)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records := s.data[collection]
+	result := make([]Record, 0)
+	for _, record := range records {
+		matched, err := parsed.Eval(record, params)
+		if err != nil {
+			return nil, err
+		}
+		if matched {
+			result = append(result, cloneRecord(record))
+		}
+	}
+	return result, nil
+}
+
+// UpdateExpr is the expression-based counterpart to Update.
+func (s *Store) UpdateExpr(collection, expr string, params map[string]any, updates Record) (int, error) {
+	if collection == "" {
+		return 0, errors.New("collection is required")
+	}
+	parsed, err := ParseExpr(expr)
+	if err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records := s.data[collection]
+	updated := 0
+	for i, record := range records {
+		matched, err := parsed.Eval(record, params)
+		if err != nil {
+			return 0, err
+		}
+		if !matched {
+			continue
+		}
+		for key, value := range updates {
+			record[key] = value
+		}
+		records[i] = record
+		updated++
+	}
+	s.data[collection] = records
+	if err := s.saveLocked(); err != nil {
+		return 0, err
+	}
+	return updated, nil
+}
+
+// DeleteExpr is the expression-based counterpart to Delete.
+func (s *Store) DeleteExpr(collection, expr string, params map[string]any) (int, error) {
+	if collection == "" {
+		return 0, errors.New("collection is required")
+	}
+	parsed, err := ParseExpr(expr)
+	if err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records := s.data[collection]
+	remaining := records[:0]
+	deleted := 0
+	for _, record := range records {
+		matched, err := parsed.Eval(record, params)
+		if err != nil {
+			return 0, err
+		}
+		if matched {
+			deleted++
+			continue
+		}
+		remaining = append(remaining, record)
+	}
+	s.data[collection] = remaining
+	if err := s.saveLocked(); err != nil {
+		return 0, err
+	}
+	return deleted, nil
+}
+
 func (s *Store) Insert(collection string, record Record) (Record, error) {
 	if collection == "" {
 		return nil, errors.New("collection is required")
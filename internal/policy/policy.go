@@ -0,0 +1,184 @@
+// Package policy implements a small casbin-style access control enforcer:
+// RBAC role links plus wildcard ("*") matching over (subject, object,
+// action) triples, loaded from a model file and a policy CSV. It is
+// deliberately a subset of the full casbin matcher language, sized to what
+// lunar-lander's Lua `auth` module needs.
+package policy
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Rule is one `p` line from the policy file: a subject allowed to perform
+// action on object. Either obj or act (or both) may be the wildcard "*".
+type Rule struct {
+	Sub string
+	Obj string
+	Act string
+}
+
+// Enforcer holds the loaded policy rules and RBAC role links. It is safe
+// for concurrent use, including concurrent reload via LoadPolicy.
+type Enforcer struct {
+	mu       sync.RWMutex
+	policies []Rule
+	roles    map[string][]string // user/role -> directly assigned roles
+}
+
+// NewEnforcer returns an empty Enforcer with no rules or role links.
+func NewEnforcer() *Enforcer {
+	return &Enforcer{roles: map[string][]string{}}
+}
+
+// LoadPolicy checks that the casbin-style model file exists (its contents
+// are not read) and reads a policy CSV with `p` and `g` rows, returning a
+// populated Enforcer.
+func LoadPolicy(modelPath, policyPath string) (*Enforcer, error) {
+	if _, err := os.Stat(modelPath); err != nil {
+		return nil, fmt.Errorf("load model: %w", err)
+	}
+	e := NewEnforcer()
+	if err := e.loadPolicyFile(policyPath); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *Enforcer) loadPolicyFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("load policy: %w", err)
+	}
+	defer f.Close()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.policies = nil
+	e.roles = map[string][]string{}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := splitFields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch strings.ToLower(fields[0]) {
+		case "p":
+			if len(fields) < 4 {
+				return fmt.Errorf("load policy: malformed p rule: %q", line)
+			}
+			e.policies = append(e.policies, Rule{Sub: fields[1], Obj: fields[2], Act: fields[3]})
+		case "g":
+			if len(fields) < 3 {
+				return fmt.Errorf("load policy: malformed g rule: %q", line)
+			}
+			e.roles[fields[1]] = append(e.roles[fields[1]], fields[2])
+		}
+	}
+	return scanner.Err()
+}
+
+func splitFields(line string) []string {
+	raw := strings.Split(line, ",")
+	fields := make([]string, len(raw))
+	for i, f := range raw {
+		fields[i] = strings.TrimSpace(f)
+	}
+	return fields
+}
+
+// AddPolicy appends a policy rule at runtime.
+func (e *Enforcer) AddPolicy(sub, obj, act string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.policies = append(e.policies, Rule{Sub: sub, Obj: obj, Act: act})
+}
+
+// RemovePolicy removes the first matching policy rule, reporting whether one
+// was found.
+func (e *Enforcer) RemovePolicy(sub, obj, act string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for i, r := range e.policies {
+		if r.Sub == sub && r.Obj == obj && r.Act == act {
+			e.policies = append(e.policies[:i], e.policies[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// AddRoleLink grants role to user (g, user, role).
+func (e *Enforcer) AddRoleLink(user, role string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.roles[user] = append(e.roles[user], role)
+}
+
+// Enforce reports whether sub may perform act on obj, expanding sub through
+// its RBAC role links and matching policy rules with "*" as a wildcard on
+// obj/act.
+func (e *Enforcer) Enforce(sub, obj, act string) bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	subjects := e.expandRoles(sub)
+	for _, r := range e.policies {
+		if !subjectMatches(subjects, r.Sub) {
+			continue
+		}
+		if !attrMatches(r.Obj, obj) {
+			continue
+		}
+		if !attrMatches(r.Act, act) {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// expandRoles returns sub plus every role it holds, transitively, following
+// g-links (e.g. a role that is itself a member of another role).
+func (e *Enforcer) expandRoles(sub string) []string {
+	seen := map[string]bool{sub: true}
+	queue := []string{sub}
+	result := []string{sub}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, role := range e.roles[current] {
+			if seen[role] {
+				continue
+			}
+			seen[role] = true
+			result = append(result, role)
+			queue = append(queue, role)
+		}
+	}
+	return result
+}
+
+func attrMatches(pattern, value string) bool {
+	return pattern == "*" || pattern == value
+}
+
+func subjectMatches(subjects []string, pattern string) bool {
+	if pattern == "*" {
+		return true
+	}
+	for _, s := range subjects {
+		if s == pattern {
+			return true
+		}
+	}
+	return false
+}
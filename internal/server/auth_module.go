@@ -0,0 +1,186 @@
+package server
+
+import (
+	"context"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yuin/gopher-lua"
+
+	"lunar-lander/internal/policy"
+	"lunar-lander/internal/watch"
+)
+
+// routeAuthSpec says how to pull (subject, object, action) out of a request
+// for a route registered with an `auth` option, e.g.
+// rest.get(path, handler, {auth = {sub = "header:X-User"}}). obj/act default
+// to the request path and method when left blank.
+type routeAuthSpec struct {
+	sub string
+	obj string
+	act string
+}
+
+// registerAuthModule exposes internal/policy's RBAC enforcer to Lua. It
+// covers role-link expansion and literal/"*"-wildcard attribute matching
+// only; ABAC-style matcher expressions over request attributes are not
+// implemented (tracked as a follow-up, the-do-language/lunar-lander#chunk0-2-abac).
+func registerAuthModule(L *lua.LState, engine *LuaEngine) {
+	mod := L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"load_policy":   engine.authLoadPolicy,
+		"add_policy":    engine.authAddPolicy,
+		"remove_policy": engine.authRemovePolicy,
+		"add_role":      engine.authAddRole,
+		"enforce":       engine.authEnforce,
+	})
+	L.SetGlobal("auth", mod)
+}
+
+func (e *LuaEngine) authLoadPolicy(L *lua.LState) int {
+	modelPath := L.CheckString(1)
+	policyPath := L.CheckString(2)
+
+	enforcer, err := policy.LoadPolicy(modelPath, policyPath)
+	if err != nil {
+		L.RaiseError("auth.load_policy: %v", err)
+		return 0
+	}
+	e.enforcer.Store(enforcer)
+	e.watchPolicyFile(modelPath, policyPath)
+	return 0
+}
+
+// watchPolicyFile hot-reloads the policy file on change, leaving the
+// previously loaded policy live if a reload fails.
+func (e *LuaEngine) watchPolicyFile(modelPath, policyPath string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	e.watchCancels = append(e.watchCancels, cancel)
+
+	watcher := watch.NewScriptWatcher(policyPath, func() {
+		reloaded, err := policy.LoadPolicy(modelPath, policyPath)
+		if err != nil {
+			return
+		}
+		e.enforcer.Store(reloaded)
+	})
+	go func() {
+		_ = watcher.Run(ctx)
+	}()
+}
+
+func (e *LuaEngine) authAddPolicy(L *lua.LState) int {
+	enforcer := e.requireEnforcer(L)
+	if enforcer == nil {
+		return 0
+	}
+	enforcer.AddPolicy(L.CheckString(1), L.CheckString(2), L.CheckString(3))
+	return 0
+}
+
+func (e *LuaEngine) authRemovePolicy(L *lua.LState) int {
+	enforcer := e.requireEnforcer(L)
+	if enforcer == nil {
+		return 0
+	}
+	removed := enforcer.RemovePolicy(L.CheckString(1), L.CheckString(2), L.CheckString(3))
+	L.Push(lua.LBool(removed))
+	return 1
+}
+
+func (e *LuaEngine) authAddRole(L *lua.LState) int {
+	enforcer := e.requireEnforcer(L)
+	if enforcer == nil {
+		return 0
+	}
+	enforcer.AddRoleLink(L.CheckString(1), L.CheckString(2))
+	return 0
+}
+
+func (e *LuaEngine) authEnforce(L *lua.LState) int {
+	enforcer := e.enforcer.Load()
+	if enforcer == nil {
+		L.Push(lua.LFalse)
+		return 1
+	}
+	L.Push(lua.LBool(enforcer.Enforce(L.CheckString(1), L.CheckString(2), L.CheckString(3))))
+	return 1
+}
+
+func (e *LuaEngine) requireEnforcer(L *lua.LState) *policy.Enforcer {
+	enforcer := e.enforcer.Load()
+	if enforcer == nil {
+		L.RaiseError("auth: no policy loaded, call auth.load_policy first")
+		return nil
+	}
+	return enforcer
+}
+
+// routeAuthSpecFromOpts reads the `auth` field (if present) out of an
+// options table passed as the argIndex-th argument to a rest.* call.
+func routeAuthSpecFromOpts(L *lua.LState, argIndex int) *routeAuthSpec {
+	if L.GetTop() < argIndex {
+		return nil
+	}
+	opts, ok := L.Get(argIndex).(*lua.LTable)
+	if !ok {
+		return nil
+	}
+	authValue, ok := opts.RawGetString("auth").(*lua.LTable)
+	if !ok {
+		return nil
+	}
+	spec := &routeAuthSpec{}
+	if v, ok := authValue.RawGetString("sub").(lua.LString); ok {
+		spec.sub = string(v)
+	}
+	if v, ok := authValue.RawGetString("obj").(lua.LString); ok {
+		spec.obj = string(v)
+	}
+	if v, ok := authValue.RawGetString("act").(lua.LString); ok {
+		spec.act = string(v)
+	}
+	return spec
+}
+
+// authorize resolves the configured (sub, obj, act) attribute extractors
+// against the live request and checks them against the loaded policy.
+func (e *LuaEngine) authorize(spec *routeAuthSpec, c *gin.Context) bool {
+	enforcer := e.enforcer.Load()
+	if enforcer == nil {
+		// Fail closed, matching auth.enforce: a route a script author
+		// explicitly marked as requiring authorization must not serve
+		// traffic unprotected just because load_policy hasn't run yet.
+		return false
+	}
+	sub := resolveAuthAttr(spec.sub, c)
+	obj := resolveAuthAttr(valueOrDefault(spec.obj, "path"), c)
+	act := resolveAuthAttr(valueOrDefault(spec.act, "method"), c)
+	return enforcer.Enforce(sub, obj, act)
+}
+
+func valueOrDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// resolveAuthAttr reads one sub/obj/act attribute out of the request
+// according to its extractor spec: "path", "method", "header:<Name>",
+// "query:<name>" or "const:<value>".
+func resolveAuthAttr(spec string, c *gin.Context) string {
+	switch {
+	case spec == "path":
+		return c.Request.URL.Path
+	case spec == "method":
+		return c.Request.Method
+	case strings.HasPrefix(spec, "header:"):
+		return c.GetHeader(strings.TrimPrefix(spec, "header:"))
+	case strings.HasPrefix(spec, "query:"):
+		return c.Query(strings.TrimPrefix(spec, "query:"))
+	case strings.HasPrefix(spec, "const:"):
+		return strings.TrimPrefix(spec, "const:")
+	default:
+		return spec
+	}
+}
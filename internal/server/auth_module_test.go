@@ -0,0 +1,61 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"lunar-lander/internal/db"
+	"lunar-lander/internal/sugardb"
+)
+
+const authBeforeLoadPolicyScript = `
+rest.get("/secret", function(req)
+	return 200, {ok = true}, {}
+end, {auth = {sub = "header:X-User"}})
+`
+
+// TestAuthorizeDeniesBeforeLoadPolicy verifies that a route registered with
+// an auth spec is denied, not silently served, when auth.load_policy hasn't
+// run yet - matching auth.enforce's own fail-closed behavior for the same
+// nil-enforcer case.
+func TestAuthorizeDeniesBeforeLoadPolicy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	scriptPath := filepath.Join(t.TempDir(), "secret.lua")
+	if err := os.WriteFile(scriptPath, []byte(authBeforeLoadPolicyScript), 0o644); err != nil {
+		t.Fatalf("write script: %v", err)
+	}
+
+	store := sugardb.NewStore()
+	defer store.Close()
+	records, err := db.Open("")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+
+	runtime, err := BuildRuntime(scriptPath, store, records, EngineOptions{
+		LuaPoolSize:      1,
+		HTTPTimeout:      5 * time.Second,
+		HTTPMaxRedirects: 10,
+		HandlerTimeout:   5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("build runtime: %v", err)
+	}
+	defer runtime.Engine.Close()
+
+	req := httptest.NewRequest(http.MethodGet, "/secret", nil)
+	req.Header.Set("X-User", "alice")
+	w := httptest.NewRecorder()
+	runtime.Router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want %d (route must deny before load_policy runs)", w.Code, http.StatusForbidden)
+	}
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// cliCommand is one subcommand registered via cmd.register in Lua.
+type cliCommand struct {
+	name    string
+	short   string
+	flags   map[string]string // flag name -> "string" | "int" | "bool"
+	handler *lua.LFunction
+}
+
+func registerCmdModule(L *lua.LState, engine *LuaEngine) {
+	mod := L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"register": engine.cmdRegister,
+	})
+	L.SetGlobal("cmd", mod)
+}
+
+// cmdRegister implements cmd.register(name, {short=..., flags={...}, run=fn}).
+func (e *LuaEngine) cmdRegister(L *lua.LState) int {
+	name := L.CheckString(1)
+	spec := L.CheckTable(2)
+
+	short := ""
+	if v, ok := spec.RawGetString("short").(lua.LString); ok {
+		short = string(v)
+	}
+
+	flags := map[string]string{}
+	if flagsTable, ok := spec.RawGetString("flags").(*lua.LTable); ok {
+		flagsTable.ForEach(func(key, value lua.LValue) {
+			flags[key.String()] = value.String()
+		})
+	}
+
+	handler, ok := spec.RawGetString("run").(*lua.LFunction)
+	if !ok {
+		L.RaiseError("cmd.register: %q is missing a run function", name)
+		return 0
+	}
+
+	if e.commands == nil {
+		e.commands = map[string]*cliCommand{}
+	}
+	e.commands[name] = &cliCommand{name: name, short: short, flags: flags, handler: handler}
+	return 0
+}
+
+// DispatchCommand parses args against the flags declared for name, invokes
+// its Lua run(args) handler, and returns the exit code and stdout it
+// reported.
+func (e *LuaEngine) DispatchCommand(name string, args []string) (int, string, error) {
+	command, ok := e.commands[name]
+	if !ok {
+		return 1, "", fmt.Errorf("unknown command %q", name)
+	}
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	strValues := map[string]*string{}
+	intValues := map[string]*int{}
+	boolValues := map[string]*bool{}
+	for flagName, flagType := range command.flags {
+		switch flagType {
+		case "int":
+			intValues[flagName] = fs.Int(flagName, 0, "")
+		case "bool":
+			boolValues[flagName] = fs.Bool(flagName, false, "")
+		default:
+			strValues[flagName] = fs.String(flagName, "", "")
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return 1, "", err
+	}
+
+	parsed := map[string]any{}
+	for flagName, value := range strValues {
+		parsed[flagName] = *value
+	}
+	for flagName, value := range intValues {
+		parsed[flagName] = *value
+	}
+	for flagName, value := range boolValues {
+		parsed[flagName] = *value
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err := e.L.CallByParam(lua.P{Fn: command.handler, NRet: 2, Protect: true}, goValueToLua(e.L, parsed)); err != nil {
+		return 1, "", err
+	}
+	codeValue := e.L.Get(-2)
+	outputValue := e.L.Get(-1)
+	e.L.Pop(2)
+
+	code := 0
+	if codeValue.Type() == lua.LTNumber {
+		code = int(lua.LVAsNumber(codeValue))
+	}
+	output := ""
+	if outputValue.Type() == lua.LTString {
+		output = outputValue.String()
+	}
+	return code, output, nil
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"github.com/yuin/gopher-lua"
+
+	"lunar-lander/internal/db"
+)
+
+// registerDBModule exposes internal/db.Store to Lua as the `db` global:
+// persisted collections, queried either by equality criteria or by the
+// expression language implemented in db.ParseExpr.
+func registerDBModule(L *lua.LState, engine *LuaEngine) {
+	mod := L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"query":  engine.dbQuery,
+		"insert": engine.dbInsert,
+		"update": engine.dbUpdate,
+		"delete": engine.dbDelete,
+	})
+	L.SetGlobal("db", mod)
+}
+
+func (e *LuaEngine) dbQuery(L *lua.LState) int {
+	collection := L.CheckString(1)
+
+	if expr, ok := L.Get(2).(lua.LString); ok {
+		params := db.Record{}
+		if L.GetTop() >= 3 {
+			if table, ok := L.Get(3).(*lua.LTable); ok {
+				params = luaTableToMap(table)
+			}
+		}
+		results, err := e.db.QueryExpr(collection, string(expr), params)
+		if err != nil {
+			L.RaiseError("db.query failed: %v", err)
+			return 0
+		}
+		L.Push(goValueToLua(L, recordsToAny(results)))
+		return 1
+	}
+
+	criteria := db.Record{}
+	if L.GetTop() >= 2 {
+		if table, ok := L.Get(2).(*lua.LTable); ok {
+			criteria = luaTableToMap(table)
+		}
+	}
+	results, err := e.db.Query(collection, criteria)
+	if err != nil {
+		L.RaiseError("db.query failed: %v", err)
+		return 0
+	}
+	L.Push(goValueToLua(L, recordsToAny(results)))
+	return 1
+}
+
+func (e *LuaEngine) dbInsert(L *lua.LState) int {
+	collection := L.CheckString(1)
+	recordTable := L.CheckTable(2)
+	record, err := e.db.Insert(collection, luaTableToMap(recordTable))
+	if err != nil {
+		L.RaiseError("db.insert failed: %v", err)
+		return 0
+	}
+	L.Push(goValueToLua(L, map[string]any(record)))
+	return 1
+}
+
+func (e *LuaEngine) dbUpdate(L *lua.LState) int {
+	collection := L.CheckString(1)
+
+	if expr, ok := L.Get(2).(lua.LString); ok {
+		params := db.Record{}
+		updatesIndex := 3
+		if L.GetTop() >= 4 {
+			if table, ok := L.Get(3).(*lua.LTable); ok {
+				params = luaTableToMap(table)
+			}
+			updatesIndex = 4
+		}
+		updatesTable := L.CheckTable(updatesIndex)
+		updated, err := e.db.UpdateExpr(collection, string(expr), params, luaTableToMap(updatesTable))
+		if err != nil {
+			L.RaiseError("db.update failed: %v", err)
+			return 0
+		}
+		L.Push(lua.LNumber(updated))
+		return 1
+	}
+
+	criteriaTable := L.CheckTable(2)
+	updatesTable := L.CheckTable(3)
+	updated, err := e.db.Update(collection, luaTableToMap(criteriaTable), luaTableToMap(updatesTable))
+	if err != nil {
+		L.RaiseError("db.update failed: %v", err)
+		return 0
+	}
+	L.Push(lua.LNumber(updated))
+	return 1
+}
+
+func (e *LuaEngine) dbDelete(L *lua.LState) int {
+	collection := L.CheckString(1)
+
+	if expr, ok := L.Get(2).(lua.LString); ok {
+		params := db.Record{}
+		if L.GetTop() >= 3 {
+			if table, ok := L.Get(3).(*lua.LTable); ok {
+				params = luaTableToMap(table)
+			}
+		}
+		deleted, err := e.db.DeleteExpr(collection, string(expr), params)
+		if err != nil {
+			L.RaiseError("db.delete failed: %v", err)
+			return 0
+		}
+		L.Push(lua.LNumber(deleted))
+		return 1
+	}
+
+	criteriaTable := L.CheckTable(2)
+	deleted, err := e.db.Delete(collection, luaTableToMap(criteriaTable))
+	if err != nil {
+		L.RaiseError("db.delete failed: %v", err)
+		return 0
+	}
+	L.Push(lua.LNumber(deleted))
+	return 1
+}
+
+func recordsToAny(records []db.Record) []any {
+	result := make([]any, len(records))
+	for i, record := range records {
+		result[i] = map[string]any(record)
+	}
+	return result
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"lunar-lander/internal/db"
+	"lunar-lander/internal/sugardb"
+)
+
+const infiniteLoopScript = `
+rest.get("/spin", function(req)
+	while true do end
+	return 200, {ok = true}, {}
+end)
+`
+
+// TestHandlerTimeoutInterruptsInfiniteLoop verifies that a handler stuck in
+// an infinite loop is cut off once HandlerTimeout elapses, rather than
+// hanging the request (or the whole pool replica) forever.
+func TestHandlerTimeoutInterruptsInfiniteLoop(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	scriptPath := filepath.Join(t.TempDir(), "spin.lua")
+	if err := os.WriteFile(scriptPath, []byte(infiniteLoopScript), 0o644); err != nil {
+		t.Fatalf("write script: %v", err)
+	}
+
+	store := sugardb.NewStore()
+	defer store.Close()
+	records, err := db.Open("")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+
+	runtime, err := BuildRuntime(scriptPath, store, records, EngineOptions{
+		LuaPoolSize:      1,
+		HTTPTimeout:      5 * time.Second,
+		HTTPMaxRedirects: 10,
+		HandlerTimeout:   100 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("build runtime: %v", err)
+	}
+	defer runtime.Engine.Close()
+
+	req := httptest.NewRequest(http.MethodGet, "/spin", nil)
+	w := httptest.NewRecorder()
+
+	done := make(chan struct{})
+	go func() {
+		runtime.Router.ServeHTTP(w, req)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("handler was not interrupted within the budget")
+	}
+
+	if w.Code != http.StatusGatewayTimeout {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusGatewayTimeout)
+	}
+}
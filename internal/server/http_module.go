@@ -0,0 +1,189 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// newHTTPClient builds the single *http.Client shared by every http.* Lua
+// call (and every replica in the Lua state pool, since *http.Client is
+// already safe for concurrent use). maxRedirects < 0 means unlimited.
+func newHTTPClient(timeout time.Duration, maxRedirects int, proxyURL string) (*http.Client, error) {
+	transport := &http.Transport{}
+	if proxyURL != "" {
+		parsed, err := url.Parse(proxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid http proxy url: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(parsed)
+	}
+
+	client := &http.Client{Timeout: timeout, Transport: transport}
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		// len(via) is the number of this redirect (1 for the first).
+		if maxRedirects >= 0 && len(via) > maxRedirects {
+			return http.ErrUseLastResponse
+		}
+		return nil
+	}
+	return client, nil
+}
+
+// registerHTTPModule exposes outbound HTTP calls to Lua as the `http`
+// global, gluahttp-style: http.get/post/put/patch/delete/head(url, opts)
+// and the lower-level http.request(opts) where opts also carries method
+// and url. opts may set query, headers, body, form and a per-call timeout
+// (seconds); the response is {status, headers, body, body_json()}.
+func registerHTTPModule(L *lua.LState, engine *LuaEngine) {
+	mod := L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"get":     engine.httpCall(http.MethodGet),
+		"post":    engine.httpCall(http.MethodPost),
+		"put":     engine.httpCall(http.MethodPut),
+		"patch":   engine.httpCall(http.MethodPatch),
+		"delete":  engine.httpCall(http.MethodDelete),
+		"head":    engine.httpCall(http.MethodHead),
+		"request": engine.httpRequest,
+	})
+	L.SetGlobal("http", mod)
+}
+
+func (e *LuaEngine) httpCall(method string) lua.LGFunction {
+	return func(L *lua.LState) int {
+		rawURL := L.CheckString(1)
+		var opts *lua.LTable
+		if L.GetTop() >= 2 {
+			opts, _ = L.Get(2).(*lua.LTable)
+		}
+		return e.doHTTPRequest(L, method, rawURL, opts)
+	}
+}
+
+func (e *LuaEngine) httpRequest(L *lua.LState) int {
+	opts := L.CheckTable(1)
+	method := http.MethodGet
+	if v, ok := opts.RawGetString("method").(lua.LString); ok && v != "" {
+		method = strings.ToUpper(string(v))
+	}
+	rawURL, ok := opts.RawGetString("url").(lua.LString)
+	if !ok {
+		L.RaiseError("http.request: opts.url is required")
+		return 0
+	}
+	return e.doHTTPRequest(L, method, string(rawURL), opts)
+}
+
+func (e *LuaEngine) doHTTPRequest(L *lua.LState, method, rawURL string, opts *lua.LTable) int {
+	verb := strings.ToLower(method)
+
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		L.RaiseError("http.%s: invalid url: %v", verb, err)
+		return 0
+	}
+
+	var bodyReader io.Reader
+	contentType := ""
+	if opts != nil {
+		if query, ok := opts.RawGetString("query").(*lua.LTable); ok {
+			values := parsed.Query()
+			query.ForEach(func(key, value lua.LValue) {
+				values.Set(key.String(), value.String())
+			})
+			parsed.RawQuery = values.Encode()
+		}
+		if form, ok := opts.RawGetString("form").(*lua.LTable); ok {
+			values := url.Values{}
+			form.ForEach(func(key, value lua.LValue) {
+				values.Set(key.String(), value.String())
+			})
+			bodyReader = strings.NewReader(values.Encode())
+			contentType = "application/x-www-form-urlencoded"
+		} else if body, ok := opts.RawGetString("body").(lua.LString); ok {
+			bodyReader = strings.NewReader(string(body))
+		}
+	}
+
+	req, err := http.NewRequest(method, parsed.String(), bodyReader)
+	if err != nil {
+		L.RaiseError("http.%s: %v", verb, err)
+		return 0
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	client := e.httpClient
+	if opts != nil {
+		if headers, ok := opts.RawGetString("headers").(*lua.LTable); ok {
+			headers.ForEach(func(key, value lua.LValue) {
+				req.Header.Set(key.String(), value.String())
+			})
+		}
+		if seconds, ok := opts.RawGetString("timeout").(lua.LNumber); ok {
+			perCall := *client
+			perCall.Timeout = time.Duration(float64(seconds) * float64(time.Second))
+			client = &perCall
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		L.RaiseError("http.%s %s: %v", verb, rawURL, err)
+		return 0
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		L.RaiseError("http.%s %s: reading response: %v", verb, rawURL, err)
+		return 0
+	}
+
+	L.Push(httpResponseTable(L, resp, raw))
+	return 1
+}
+
+func httpResponseTable(L *lua.LState, resp *http.Response, body []byte) *lua.LTable {
+	table := L.NewTable()
+	table.RawSetString("status", lua.LNumber(resp.StatusCode))
+	table.RawSetString("body", lua.LString(string(body)))
+
+	headers := L.NewTable()
+	keys := make([]string, 0, len(resp.Header))
+	for k := range resp.Header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		values := resp.Header[k]
+		if len(values) == 1 {
+			headers.RawSetString(k, lua.LString(values[0]))
+			continue
+		}
+		list := L.NewTable()
+		for i, v := range values {
+			list.RawSetInt(i+1, lua.LString(v))
+		}
+		headers.RawSetString(k, list)
+	}
+	table.RawSetString("headers", headers)
+
+	table.RawSetString("body_json", L.NewFunction(func(L *lua.LState) int {
+		var decoded any
+		if err := json.Unmarshal(body, &decoded); err != nil {
+			L.RaiseError("body_json: %v", err)
+			return 0
+		}
+		L.Push(goValueToLua(L, decoded))
+		return 1
+	}))
+	return table
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"encoding/json"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// jsonNull marks a Lua value as JSON's explicit null, as opposed to a table
+// key that's simply absent: assigning lua.LNil to a table key removes it,
+// so json.decode can't otherwise represent {"foo": null} as a present key.
+type jsonNull struct{}
+
+// registerJSONModule exposes json.encode/decode and the json.null sentinel.
+// It needs no pool-specific variant: encode/decode are stateless, and the
+// sentinel is a fresh per-state userdata anyway, so the loader and every
+// pool replica (see lua_pool.go) just call this once each.
+func registerJSONModule(L *lua.LState) {
+	null := L.NewUserData()
+	null.Value = jsonNull{}
+
+	mod := L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"encode": jsonEncode,
+		"decode": jsonDecode(null),
+	})
+	mod.RawSetString("null", null)
+	L.SetGlobal("json", mod)
+}
+
+func jsonEncode(L *lua.LState) int {
+	value := L.CheckAny(1)
+	encoded, err := json.Marshal(luaValueToGo(value))
+	if err != nil {
+		L.RaiseError("json.encode: %v", err)
+		return 0
+	}
+	L.Push(lua.LString(encoded))
+	return 1
+}
+
+func jsonDecode(null *lua.LUserData) lua.LGFunction {
+	return func(L *lua.LState) int {
+		raw := L.CheckString(1)
+		value, err := decodeJSON(L, null, []byte(raw))
+		if err != nil {
+			L.RaiseError("json.decode: %v", err)
+			return 0
+		}
+		L.Push(value)
+		return 1
+	}
+}
+
+func decodeJSON(L *lua.LState, null *lua.LUserData, raw []byte) (lua.LValue, error) {
+	var decoded any
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		return nil, err
+	}
+	return jsonValueToLua(L, null, decoded), nil
+}
+
+// jsonValueToLua is goValueToLua plus null in place of a bare Go nil, so an
+// explicit JSON null survives as a distinguishable table value.
+func jsonValueToLua(L *lua.LState, null *lua.LUserData, value any) lua.LValue {
+	if value == nil {
+		return null
+	}
+	switch typed := value.(type) {
+	case map[string]any:
+		table := L.NewTable()
+		for key, item := range typed {
+			table.RawSetString(key, jsonValueToLua(L, null, item))
+		}
+		return table
+	case []any:
+		table := L.NewTable()
+		for i, item := range typed {
+			table.RawSetInt(i+1, jsonValueToLua(L, null, item))
+		}
+		return table
+	default:
+		return goValueToLua(L, value)
+	}
+}
+
+// jsonNullSentinel looks up the json.null userdata already registered on L,
+// so other code (request.json decoding) can produce nulls indistinguishable
+// from ones json.decode itself would produce.
+func jsonNullSentinel(L *lua.LState) *lua.LUserData {
+	if mod, ok := L.GetGlobal("json").(*lua.LTable); ok {
+		if null, ok := mod.RawGetString("null").(*lua.LUserData); ok {
+			return null
+		}
+	}
+	return L.NewUserData()
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/yuin/gopher-lua"
+)
+
+// baseLogger is the process-wide zerolog logger; ConfigureLogging
+// reconfigures it from the -log-format/-log-level flags, and
+// requestLogger/reqLogTable derive request-scoped loggers from it.
+var baseLogger = zerolog.New(os.Stdout).With().Timestamp().Logger()
+
+// ConfigureLogging sets the global log level and output format ("json" or
+// "console"). It should be called once at startup before any requests are
+// served.
+func ConfigureLogging(format, level string) {
+	if lvl, err := zerolog.ParseLevel(level); err == nil {
+		zerolog.SetGlobalLevel(lvl)
+	}
+
+	var writer io.Writer = os.Stdout
+	if format == "console" {
+		writer = zerolog.ConsoleWriter{Out: os.Stdout, TimeFormat: time.RFC3339}
+	}
+	baseLogger = zerolog.New(writer).With().Timestamp().Logger()
+}
+
+func newRequestID() string {
+	var raw [16]byte
+	_, _ = rand.Read(raw[:])
+	return hex.EncodeToString(raw[:])
+}
+
+func requestLogger(requestID string) zerolog.Logger {
+	return baseLogger.With().Str("request_id", requestID).Logger()
+}
+
+// registerLogModule exposes the process-wide logger to Lua as the `log`
+// global; a per-request logger bound to a request ID is attached to
+// req.log by attachRoute instead.
+func registerLogModule(L *lua.LState) {
+	mod := L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"info":  logAt(baseLoggerLevel(zerolog.InfoLevel)),
+		"warn":  logAt(baseLoggerLevel(zerolog.WarnLevel)),
+		"error": logAt(baseLoggerLevel(zerolog.ErrorLevel)),
+		"debug": logAt(baseLoggerLevel(zerolog.DebugLevel)),
+	})
+	L.SetGlobal("log", mod)
+}
+
+// baseLoggerLevel defers the logger lookup to call time so a later
+// ConfigureLogging call is honored.
+func baseLoggerLevel(level zerolog.Level) func() *zerolog.Event {
+	return func() *zerolog.Event { return baseLogger.WithLevel(level) }
+}
+
+func logAt(eventFn func() *zerolog.Event) lua.LGFunction {
+	return func(L *lua.LState) int {
+		msg := L.CheckString(1)
+		event := eventFn()
+		if L.GetTop() >= 2 {
+			if fields, ok := L.Get(2).(*lua.LTable); ok {
+				applyLuaFields(event, fields)
+			}
+		}
+		event.Msg(msg)
+		return 0
+	}
+}
+
+func applyLuaFields(event *zerolog.Event, fields *lua.LTable) {
+	fields.ForEach(func(key, value lua.LValue) {
+		event.Interface(key.String(), luaValueToGo(value))
+	})
+}
+
+// reqLogTable builds the req.log object passed to every Lua handler,
+// emitting log lines (in the ConfigureLogging format) tagged with this
+// request's ID.
+func reqLogTable(L *lua.LState, logger zerolog.Logger) *lua.LTable {
+	table := L.NewTable()
+	table.RawSetString("info", L.NewFunction(reqLogAt(logger, zerolog.InfoLevel)))
+	table.RawSetString("warn", L.NewFunction(reqLogAt(logger, zerolog.WarnLevel)))
+	table.RawSetString("error", L.NewFunction(reqLogAt(logger, zerolog.ErrorLevel)))
+	table.RawSetString("debug", L.NewFunction(reqLogAt(logger, zerolog.DebugLevel)))
+	return table
+}
+
+func reqLogAt(logger zerolog.Logger, level zerolog.Level) lua.LGFunction {
+	return logAt(func() *zerolog.Event { return logger.WithLevel(level) })
+}
@@ -1,67 +1,187 @@
 package server
 
 import (
+	"context"
 	"errors"
 	"io"
+	"mime"
 	"net/http"
+	"net/url"
 	"os"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/yuin/gopher-lua"
 
+	"lunar-lander/internal/db"
+	"lunar-lander/internal/policy"
 	"lunar-lander/internal/sugardb"
 )
 
+// LuaEngine.L is the "loader" state: the only one that ever touches route
+// and rpcServices, since those drive gin registration and must only happen
+// once. Request handling for plain rest.*, rest.websocket and rest.sse
+// routes instead runs on a pooled replica state (see lua_pool.go) so
+// concurrent requests, including long-lived streaming connections, no
+// longer serialize through a single interpreter; rpc/cmd handlers still run
+// on the loader under mu, which is a smaller, known-serialized surface left
+// for a future pass.
 type LuaEngine struct {
-	L     *lua.LState
-	mu    sync.Mutex
-	route *gin.Engine
-	refs  []*lua.LFunction
+	L               *lua.LState
+	mu              sync.Mutex
+	route           *gin.Engine
+	refs            []*lua.LFunction
+	rpcServices     []*rpcService
+	db              *db.Store
+	commands        map[string]*cliCommand
+	store           *sugardb.Store
+	scriptPath      string
+	httpClient      *http.Client
+	handlerTimeout  time.Duration
+	templatesDir    string
+	render          *templateState
+	middlewareCount int
+
+	pool chan *poolEntry
+
+	enforcer     atomic.Pointer[policy.Enforcer]
+	watchCancels []context.CancelFunc
+}
+
+// EngineOptions bundles the NewLuaEngine/BuildRuntime knobs that sit behind
+// CLI flags, so adding another one (pool sizing, the outbound HTTP client's
+// tuning) doesn't keep growing either function's positional parameter list.
+type EngineOptions struct {
+	LuaPoolSize int
+
+	HTTPTimeout      time.Duration
+	HTTPMaxRedirects int
+	HTTPProxy        string
+
+	// HandlerTimeout bounds how long a single rest.* handler invocation may
+	// run before its context is cancelled; gopher-lua checks this context
+	// while executing and aborts the call once it's done.
+	HandlerTimeout time.Duration
+
+	// TemplatesDir is scanned for html/template files at load time; empty
+	// means the script doesn't render templates.
+	TemplatesDir string
 }
 
-func NewLuaEngine(router *gin.Engine, store *sugardb.Store) *LuaEngine {
+func NewLuaEngine(router *gin.Engine, store *sugardb.Store, records *db.Store, opts EngineOptions) (*LuaEngine, error) {
+	httpClient, err := newHTTPClient(opts.HTTPTimeout, opts.HTTPMaxRedirects, opts.HTTPProxy)
+	if err != nil {
+		return nil, err
+	}
+
 	L := lua.NewState()
-	engine := &LuaEngine{L: L, route: router}
+	engine := &LuaEngine{
+		L:              L,
+		route:          router,
+		db:             records,
+		store:          store,
+		httpClient:     httpClient,
+		handlerTimeout: opts.HandlerTimeout,
+		templatesDir:   opts.TemplatesDir,
+		render:         newTemplateState(),
+	}
 	registerRestModule(L, engine)
 	registerSugarDBModule(L, store)
-	return engine
+	registerDBModule(L, engine)
+	registerRPCModule(L, engine)
+	registerAuthModule(L, engine)
+	registerCmdModule(L, engine)
+	registerHTTPModule(L, engine)
+	registerLogModule(L)
+	registerRenderModule(L, engine.render)
+	registerJSONModule(L)
+	registerURLModule(L)
+	registerYAMLModule(L)
+	return engine, nil
 }
 
 func (e *LuaEngine) Close() {
 	if e == nil || e.L == nil {
 		return
 	}
+	for _, cancel := range e.watchCancels {
+		cancel()
+	}
+	draining := true
+	for draining {
+		select {
+		case entry := <-e.pool:
+			entry.L.Close()
+		default:
+			draining = false
+		}
+	}
 	e.L.Close()
 }
 
-func (e *LuaEngine) LoadScript(path string) error {
+// LoadScript runs path on the loader state, which registers every real gin
+// route, then spins up poolSize replica states (each re-running the same
+// script so its handler closures exist independently) to serve rest.*
+// requests without contending for the loader.
+func (e *LuaEngine) LoadScript(path string, poolSize int) error {
 	if path == "" {
 		return errors.New("script path is required")
 	}
 	if _, err := os.Stat(path); err != nil {
 		return err
 	}
-	return e.L.DoFile(path)
+	e.scriptPath = path
+	if err := e.L.DoFile(path); err != nil {
+		return err
+	}
+	if err := e.render.loadTemplates(e.L, e.templatesDir); err != nil {
+		return err
+	}
+	return e.buildPool(poolSize)
 }
 
 func registerRestModule(L *lua.LState, engine *LuaEngine) {
-	mod := L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
-		"get":    engine.registerRoute(http.MethodGet),
-		"post":   engine.registerRoute(http.MethodPost),
-		"put":    engine.registerRoute(http.MethodPut),
-		"patch":  engine.registerRoute(http.MethodPatch),
-		"delete": engine.registerRoute(http.MethodDelete),
-		"any":    engine.registerAnyRoute,
+	scope := &restScope{engine: engine}
+	L.SetGlobal("rest", scope.table(L))
+}
+
+// restScope threads a path prefix and the middleware IDs currently in scope
+// through nested rest.group calls: middleware only applies to routes
+// registered after it within the same scope (a rest.use call doesn't
+// retroactively affect routes registered earlier), and group prefixes
+// nest. The top-level rest table is just a restScope with no prefix and no
+// middleware.
+type restScope struct {
+	engine        *LuaEngine
+	prefix        string
+	middlewareIDs []int
+}
+
+func (s *restScope) table(L *lua.LState) *lua.LTable {
+	return L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"get":       s.registerRoute(http.MethodGet),
+		"post":      s.registerRoute(http.MethodPost),
+		"put":       s.registerRoute(http.MethodPut),
+		"patch":     s.registerRoute(http.MethodPatch),
+		"delete":    s.registerRoute(http.MethodDelete),
+		"any":       s.registerAnyRoute,
+		"websocket": s.engine.registerWebSocket(s.prefix),
+		"sse":       s.engine.registerSSE(s.prefix),
+		"cancelled": restCancelled,
+		"use":       s.registerMiddleware,
+		"group":     s.registerGroup,
 	})
-	L.SetGlobal("rest", mod)
 }
 
-func (e *LuaEngine) registerAnyRoute(L *lua.LState) int {
+func (s *restScope) registerAnyRoute(L *lua.LState) int {
 	path := L.CheckString(1)
 	handler := L.CheckFunction(2)
+	authSpec := routeAuthSpecFromOpts(L, 3)
+	middlewareIDs := s.snapshotMiddleware()
 	methods := []string{
 		http.MethodGet,
 		http.MethodPost,
@@ -70,38 +190,124 @@ func (e *LuaEngine) registerAnyRoute(L *lua.LState) int {
 		http.MethodDelete,
 	}
 	for _, method := range methods {
-		e.attachRoute(method, path, handler)
+		s.engine.attachRoute(method, s.prefix+path, handler, authSpec, middlewareIDs)
 	}
 	return 0
 }
 
-func (e *LuaEngine) registerRoute(method string) lua.LGFunction {
+func (s *restScope) registerRoute(method string) lua.LGFunction {
 	return func(L *lua.LState) int {
 		path := L.CheckString(1)
 		handler := L.CheckFunction(2)
-		e.attachRoute(method, path, handler)
+		authSpec := routeAuthSpecFromOpts(L, 3)
+		s.engine.attachRoute(method, s.prefix+path, handler, authSpec, s.snapshotMiddleware())
 		return 0
 	}
 }
 
-func (e *LuaEngine) attachRoute(method, path string, handler *lua.LFunction) {
+// registerMiddleware implements rest.use(fn): fn is pinned on the engine
+// (registerRestModulePool pins its own replica-local copy) and assigned the
+// next sequential ID, which lines up with the pool replicas' own
+// entry.middlewares since every replica re-runs the same script in the
+// same order.
+func (s *restScope) registerMiddleware(L *lua.LState) int {
+	fn := L.CheckFunction(1)
+	s.middlewareIDs = append(s.middlewareIDs, s.engine.addMiddleware(fn))
+	return 0
+}
+
+// registerGroup implements rest.group(prefix, fn): fn is called once with a
+// scoped table whose get/post/... prepend prefix and whose use inherits
+// (a snapshot of) the enclosing scope's middleware stack.
+func (s *restScope) registerGroup(L *lua.LState) int {
+	prefix := L.CheckString(1)
+	fn := L.CheckFunction(2)
+	nested := &restScope{engine: s.engine, prefix: s.prefix + prefix, middlewareIDs: s.snapshotMiddleware()}
+	if err := L.CallByParam(lua.P{Fn: fn, NRet: 0, Protect: true}, nested.table(L)); err != nil {
+		L.RaiseError("rest.group %q: %v", prefix, err)
+	}
+	return 0
+}
+
+func (s *restScope) snapshotMiddleware() []int {
+	ids := make([]int, len(s.middlewareIDs))
+	copy(ids, s.middlewareIDs)
+	return ids
+}
+
+func (e *LuaEngine) addMiddleware(fn *lua.LFunction) int {
+	e.refs = append(e.refs, fn)
+	id := e.middlewareCount
+	e.middlewareCount++
+	return id
+}
+
+func (e *LuaEngine) attachRoute(method, path string, handler *lua.LFunction, authSpec *routeAuthSpec, middlewareIDs []int) {
 	e.refs = append(e.refs, handler)
+	id := routeID(method, path)
+
 	e.route.Handle(method, path, func(c *gin.Context) {
-		e.mu.Lock()
-		defer e.mu.Unlock()
+		if authSpec != nil && !e.authorize(authSpec, c) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+
+		requestID := c.GetHeader("X-Request-ID")
+		if requestID == "" {
+			requestID = newRequestID()
+		}
+		c.Header("X-Request-ID", requestID)
+
+		logger := requestLogger(requestID)
+		start := time.Now()
+		logger.Info().
+			Str("method", c.Request.Method).
+			Str("path", c.Request.URL.Path).
+			Str("client_ip", c.ClientIP()).
+			Msg("request started")
+		defer func() {
+			logger.Info().
+				Int("status", c.Writer.Status()).
+				Dur("latency", time.Since(start)).
+				Int("bytes", c.Writer.Size()).
+				Msg("request completed")
+		}()
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), e.handlerTimeout)
+		defer cancel()
 
-		reqTable, err := requestToLuaTable(e.L, c)
+		entry, ok := e.checkoutState(ctx)
+		if !ok {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "lua state pool exhausted", "code": "pool_checkout_timeout"})
+			return
+		}
+		defer e.releaseState(entry)
+
+		poolHandler, ok := entry.handlers[id]
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "handler missing from Lua state pool"})
+			return
+		}
+
+		reqTable, err := requestToLuaTable(entry.L, c)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		reqTable.RawSetString("log", reqLogTable(entry.L, logger))
+		reqTable.RawSetString("context", requestContextTable(entry.L, ctx))
 
-		if err := e.L.CallByParam(lua.P{Fn: handler, NRet: 3, Protect: true}, reqTable); err != nil {
+		entry.L.SetContext(ctx)
+		if err := runMiddlewareChain(entry.L, entry, middlewareIDs, 0, reqTable, poolHandler); err != nil {
+			if ctx.Err() == context.DeadlineExceeded {
+				c.JSON(http.StatusGatewayTimeout, gin.H{"error": "handler timed out", "code": "deadline_exceeded"})
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
-		status, body, headers := parseLuaResponse(e.L)
+		status, body, headers := parseLuaResponse(entry.L)
 		for k, v := range headers {
 			c.Header(k, v)
 		}
@@ -110,6 +316,8 @@ func (e *LuaEngine) attachRoute(method, path string, handler *lua.LFunction) {
 			return
 		}
 		switch typed := body.(type) {
+		case renderedHTML:
+			c.Data(status, "text/html; charset=utf-8", []byte(typed))
 		case string:
 			c.String(status, typed)
 		case []byte:
@@ -174,9 +382,78 @@ func requestToLuaTable(L *lua.LState, c *gin.Context) (*lua.LTable, error) {
 	}
 	req.RawSetString("params", params)
 
+	mediaType, _, _ := mime.ParseMediaType(c.Request.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/json":
+		if decoded, err := decodeJSON(L, jsonNullSentinel(L), body); err == nil {
+			req.RawSetString("json", decoded)
+		}
+	case "application/x-www-form-urlencoded":
+		if err := c.Request.ParseForm(); err == nil {
+			req.RawSetString("form", valuesToLuaTable(L, c.Request.PostForm))
+		}
+	case "multipart/form-data":
+		if err := c.Request.ParseMultipartForm(32 << 20); err == nil {
+			req.RawSetString("form", valuesToLuaTable(L, c.Request.PostForm))
+		}
+	}
+
 	return req, nil
 }
 
+func valuesToLuaTable(L *lua.LState, values url.Values) *lua.LTable {
+	table := L.NewTable()
+	for key, vals := range values {
+		if len(vals) == 1 {
+			table.RawSetString(key, lua.LString(vals[0]))
+			continue
+		}
+		list := L.NewTable()
+		for i, v := range vals {
+			list.RawSetInt(i+1, lua.LString(v))
+		}
+		table.RawSetString(key, list)
+	}
+	return table
+}
+
+// restCancelled implements rest.cancelled(), letting a handler check for
+// timeout/client-disconnect mid-loop without threading request.context
+// through every helper function; it reads the context set via
+// lua.LState.SetContext on whichever state is currently running it, and
+// reports false on a state with no context set (e.g. the loader).
+func restCancelled(L *lua.LState) int {
+	ctx := L.Context()
+	L.Push(lua.LBool(ctx != nil && ctx.Err() != nil))
+	return 1
+}
+
+// requestContextTable exposes the handler's deadline (set from
+// handlerTimeout, not just whatever the inbound request already carried)
+// and a way to poll for cancellation, so long-running handlers can
+// cooperatively bail. rest.cancelled() (lua_pool.go / registerRestModule)
+// reads the same cancellation via lua.LState.Context() instead.
+func requestContextTable(L *lua.LState, ctx context.Context) *lua.LTable {
+	table := L.NewTable()
+
+	deadlineMS := lua.LNumber(0)
+	if deadline, ok := ctx.Deadline(); ok {
+		deadlineMS = lua.LNumber(time.Until(deadline).Milliseconds())
+	}
+	table.RawSetString("deadline_ms", deadlineMS)
+
+	table.RawSetString("done", L.NewFunction(func(L *lua.LState) int {
+		select {
+		case <-ctx.Done():
+			L.Push(lua.LTrue)
+		default:
+			L.Push(lua.LFalse)
+		}
+		return 1
+	}))
+	return table
+}
+
 func parseLuaResponse(L *lua.LState) (int, any, map[string]string) {
 	defer L.Pop(3)
 	statusValue := L.Get(-3)
@@ -200,6 +477,12 @@ func parseLuaResponse(L *lua.LState) (int, any, map[string]string) {
 		body = float64(v)
 	case *lua.LNilType:
 		body = nil
+	case *lua.LUserData:
+		if html, ok := v.Value.(renderedHTML); ok {
+			body = html
+		} else {
+			body = v.String()
+		}
 	default:
 		body = v.String()
 	}
@@ -234,6 +517,11 @@ func luaValueToGo(value lua.LValue) any {
 		return bool(v)
 	case *lua.LTable:
 		return luaTableToMap(v)
+	case *lua.LUserData:
+		if _, ok := v.Value.(jsonNull); ok {
+			return nil
+		}
+		return v.String()
 	default:
 		return v.String()
 	}
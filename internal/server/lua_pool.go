@@ -0,0 +1,235 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// poolEntry is one replica Lua state handed out to a single in-flight
+// request at a time. It re-runs the whole script at build time so its
+// handler closures are its own, never shared with the loader state or any
+// other replica (gopher-lua functions aren't portable across *lua.LState
+// values), then looks handlers up by routeID instead of by the
+// *lua.LFunction the loader saw, since that pointer belongs to a different
+// state entirely.
+type poolEntry struct {
+	L           *lua.LState
+	handlers    map[string]*lua.LFunction
+	middlewares []*lua.LFunction
+	render      *templateState
+}
+
+func routeID(method, path string) string {
+	return method + " " + path
+}
+
+// buildPool spins up size replica states, each independently loading
+// scriptPath. It must run after the loader's own LoadScript call so
+// e.scriptPath is set.
+func (e *LuaEngine) buildPool(size int) error {
+	if size < 1 {
+		size = 1
+	}
+	e.pool = make(chan *poolEntry, size)
+	for i := 0; i < size; i++ {
+		entry, err := e.newPoolEntry()
+		if err != nil {
+			return fmt.Errorf("lua state pool: %w", err)
+		}
+		e.pool <- entry
+	}
+	return nil
+}
+
+// newPoolEntry builds one replica state wired up with the same db/sugardb
+// access as the loader, but with rest/auth/rpc/cmd registration trimmed
+// down to whatever is safe to run a second time: rest.get/post/websocket/sse
+// just record their handler instead of touching gin (the loader registers
+// the actual gin route, then borrows a replica's recorded handler and state
+// for the connection's lifetime - see registerWebSocket/registerSSE), and
+// calls whose side effect must happen only once (rpc.service's gin routes,
+// auth.load_policy's policy watcher, cmd.register's command registry) are
+// no-ops, since the loader already did that once for real.
+func (e *LuaEngine) newPoolEntry() (*poolEntry, error) {
+	L := lua.NewState()
+	entry := &poolEntry{L: L, handlers: map[string]*lua.LFunction{}, render: newTemplateState()}
+
+	registerRestModulePool(L, entry)
+	registerSugarDBModule(L, e.store)
+	registerDBModule(L, e)
+	registerRPCModulePool(L)
+	registerAuthModulePool(L, e)
+	registerCmdModulePool(L)
+	registerHTTPModule(L, e)
+	registerLogModule(L)
+	registerRenderModule(L, entry.render)
+	registerJSONModule(L)
+	registerURLModule(L)
+	registerYAMLModule(L)
+
+	if err := L.DoFile(e.scriptPath); err != nil {
+		L.Close()
+		return nil, err
+	}
+	if err := entry.render.loadTemplates(L, e.templatesDir); err != nil {
+		L.Close()
+		return nil, err
+	}
+	return entry, nil
+}
+
+// checkoutState blocks until a replica state is free, then hands it to the
+// caller for the duration of one request, or until ctx is done - so a pool
+// exhausted by long-lived rest.websocket/rest.sse connections can't hang
+// every other request forever; the caller should report the ctx-done case
+// as a rejection rather than wait upstream.
+func (e *LuaEngine) checkoutState(ctx context.Context) (*poolEntry, bool) {
+	select {
+	case entry := <-e.pool:
+		return entry, true
+	case <-ctx.Done():
+		return nil, false
+	}
+}
+
+func (e *LuaEngine) releaseState(entry *poolEntry) {
+	e.pool <- entry
+}
+
+func registerRestModulePool(L *lua.LState, entry *poolEntry) {
+	scope := &poolRestScope{entry: entry}
+	L.SetGlobal("rest", scope.table(L))
+}
+
+// poolRestScope mirrors restScope (lua_engine.go) on the replica side: it
+// only needs to track the combined path prefix, since unlike the loader it
+// never decides which middleware applies to which route - it just needs
+// every rest.use call, loader-side or nested in a rest.group, to land in
+// entry.middlewares in the same order the loader assigned IDs in, which
+// falls out of both sides replaying the same script deterministically.
+type poolRestScope struct {
+	entry  *poolEntry
+	prefix string
+}
+
+func (s *poolRestScope) table(L *lua.LState) *lua.LTable {
+	return L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"get":       s.recordHandler(http.MethodGet),
+		"post":      s.recordHandler(http.MethodPost),
+		"put":       s.recordHandler(http.MethodPut),
+		"patch":     s.recordHandler(http.MethodPatch),
+		"delete":    s.recordHandler(http.MethodDelete),
+		"any":       s.recordAnyHandler,
+		"websocket": s.recordHandler("WS"),
+		"sse":       s.recordHandler("SSE"),
+		"cancelled": restCancelled,
+		"use":       s.recordMiddleware,
+		"group":     s.recordGroup,
+	})
+}
+
+func (s *poolRestScope) recordHandler(method string) lua.LGFunction {
+	return func(L *lua.LState) int {
+		path := L.CheckString(1)
+		handler := L.CheckFunction(2)
+		s.entry.handlers[routeID(method, s.prefix+path)] = handler
+		return 0
+	}
+}
+
+func (s *poolRestScope) recordAnyHandler(L *lua.LState) int {
+	path := L.CheckString(1)
+	handler := L.CheckFunction(2)
+	for _, method := range []string{
+		http.MethodGet,
+		http.MethodPost,
+		http.MethodPut,
+		http.MethodPatch,
+		http.MethodDelete,
+	} {
+		s.entry.handlers[routeID(method, s.prefix+path)] = handler
+	}
+	return 0
+}
+
+func (s *poolRestScope) recordMiddleware(L *lua.LState) int {
+	fn := L.CheckFunction(1)
+	s.entry.middlewares = append(s.entry.middlewares, fn)
+	return 0
+}
+
+func (s *poolRestScope) recordGroup(L *lua.LState) int {
+	prefix := L.CheckString(1)
+	fn := L.CheckFunction(2)
+	nested := &poolRestScope{entry: s.entry, prefix: s.prefix + prefix}
+	if err := L.CallByParam(lua.P{Fn: fn, NRet: 0, Protect: true}, nested.table(L)); err != nil {
+		L.RaiseError("rest.group %q: %v", prefix, err)
+	}
+	return 0
+}
+
+// runMiddlewareChain walks middlewareIDs in order, invoking each recorded
+// middleware with a next closure that continues the chain; once the chain
+// is exhausted it calls handler directly. Every middleware and handler call
+// shares the same NRet: 3 calling convention attachRoute already expects
+// from parseLuaResponse, so a middleware that short-circuits (returns
+// status/body/headers without calling next) looks identical to a handler
+// returning a response.
+func runMiddlewareChain(L *lua.LState, entry *poolEntry, middlewareIDs []int, idx int, reqTable *lua.LTable, handler *lua.LFunction) error {
+	if idx >= len(middlewareIDs) {
+		return L.CallByParam(lua.P{Fn: handler, NRet: 3, Protect: true}, reqTable)
+	}
+	id := middlewareIDs[idx]
+	if id < 0 || id >= len(entry.middlewares) {
+		return fmt.Errorf("middleware %d missing from Lua state pool", id)
+	}
+	mw := entry.middlewares[id]
+
+	next := L.NewFunction(func(L *lua.LState) int {
+		if err := runMiddlewareChain(L, entry, middlewareIDs, idx+1, reqTable, handler); err != nil {
+			L.RaiseError("%v", err)
+			return 0
+		}
+		return 3
+	})
+	return L.CallByParam(lua.P{Fn: mw, NRet: 3, Protect: true}, reqTable, next)
+}
+
+// registerRPCModulePool defines rpc.service as a no-op: RPC routes are
+// declared once by the loader and continue to be served from there.
+func registerRPCModulePool(L *lua.LState) {
+	mod := L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"service": noopLuaFunc,
+	})
+	L.SetGlobal("rpc", mod)
+}
+
+// registerCmdModulePool defines cmd.register as a no-op: CLI subcommands
+// are declared once by the loader and dispatched from there.
+func registerCmdModulePool(L *lua.LState) {
+	mod := L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"register": noopLuaFunc,
+	})
+	L.SetGlobal("cmd", mod)
+}
+
+// registerAuthModulePool wires enforce/add_policy/remove_policy/add_role
+// straight to the engine's existing implementations, which only ever touch
+// the shared atomic enforcer pointer and are already state-agnostic.
+// load_policy is a no-op: the loader already loaded the policy once and
+// started the one watcher that keeps it fresh.
+func registerAuthModulePool(L *lua.LState, engine *LuaEngine) {
+	mod := L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"load_policy":   noopLuaFunc,
+		"add_policy":    engine.authAddPolicy,
+		"remove_policy": engine.authRemovePolicy,
+		"add_role":      engine.authAddRole,
+		"enforce":       engine.authEnforce,
+	})
+	L.SetGlobal("auth", mod)
+}
+
+func noopLuaFunc(L *lua.LState) int { return 0 }
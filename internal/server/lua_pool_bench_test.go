@@ -0,0 +1,78 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"lunar-lander/internal/db"
+	"lunar-lander/internal/sugardb"
+)
+
+const benchScript = `
+rest.get("/ping", function(req)
+	return 200, {ok = true}, {}
+end)
+`
+
+func benchRuntime(b *testing.B, poolSize int) *Runtime {
+	b.Helper()
+	gin.SetMode(gin.TestMode)
+
+	scriptPath := filepath.Join(b.TempDir(), "bench.lua")
+	if err := os.WriteFile(scriptPath, []byte(benchScript), 0o644); err != nil {
+		b.Fatalf("write bench script: %v", err)
+	}
+
+	store := sugardb.NewStore()
+	b.Cleanup(store.Close)
+	records, err := db.Open("")
+	if err != nil {
+		b.Fatalf("open db: %v", err)
+	}
+
+	runtime, err := BuildRuntime(scriptPath, store, records, EngineOptions{
+		LuaPoolSize:      poolSize,
+		HTTPTimeout:      5 * time.Second,
+		HTTPMaxRedirects: 10,
+		HandlerTimeout:   5 * time.Second,
+	})
+	if err != nil {
+		b.Fatalf("build runtime: %v", err)
+	}
+	b.Cleanup(runtime.Engine.Close)
+	return runtime
+}
+
+// BenchmarkRestHandlerSingleState pins the pool to one replica, so every
+// concurrent request still serializes behind the same *lua.LState.
+func BenchmarkRestHandlerSingleState(b *testing.B) {
+	runtime := benchRuntime(b, 1)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+		for pb.Next() {
+			w := httptest.NewRecorder()
+			runtime.Router.ServeHTTP(w, req)
+		}
+	})
+}
+
+// BenchmarkRestHandlerPooled gives up to 8 concurrent requests a replica
+// each; any further parallel requests wait for a free replica.
+func BenchmarkRestHandlerPooled(b *testing.B) {
+	runtime := benchRuntime(b, 8)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+		for pb.Next() {
+			w := httptest.NewRecorder()
+			runtime.Router.ServeHTTP(w, req)
+		}
+	})
+}
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"fmt"
+	"html/template"
+	"path/filepath"
+	"strings"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// renderedHTML marks a render.html() result so attachRoute's response
+// switch can tell a rendered template apart from a plain string body and
+// write it with the right content type, instead of guessing from shape.
+type renderedHTML string
+
+// templateState is the render module's state for one Lua interpreter: the
+// loader gets its own (see lua_engine.go) and every pool replica gets its
+// own (see lua_pool.go), mirroring how rest.* handlers are bound per state
+// rather than shared, since both html/template funcs and Lua closures only
+// make sense tied to the *lua.LState that registered them.
+type templateState struct {
+	tmpl    *template.Template
+	filters map[string]*lua.LFunction
+	hooks   map[string][]*lua.LFunction
+}
+
+func newTemplateState() *templateState {
+	return &templateState{
+		filters: map[string]*lua.LFunction{},
+		hooks:   map[string][]*lua.LFunction{},
+	}
+}
+
+// loadTemplates parses every file directly under dir, turning each filter
+// registered via render.filter into a template.FuncMap entry. It must run
+// after the script has finished executing, since filters are only known
+// once render.filter has actually been called. An empty dir means the
+// script doesn't use templates.
+func (rs *templateState) loadTemplates(L *lua.LState, dir string) error {
+	if dir == "" {
+		return nil
+	}
+	matches, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		return fmt.Errorf("templates dir %q: %w", dir, err)
+	}
+	if len(matches) == 0 {
+		return nil
+	}
+
+	funcMap := template.FuncMap{}
+	for name, fn := range rs.filters {
+		funcMap[name] = rs.callFilter(L, fn)
+	}
+
+	tmpl, err := template.New(filepath.Base(dir)).Funcs(funcMap).ParseFiles(matches...)
+	if err != nil {
+		return fmt.Errorf("parsing templates in %q: %w", dir, err)
+	}
+	rs.tmpl = tmpl
+	return nil
+}
+
+// callFilter adapts a Lua function registered via render.filter into a
+// template.FuncMap entry: args arrive as Go values via goValueToLua and the
+// single return value goes back through luaValueToGo.
+func (rs *templateState) callFilter(L *lua.LState, fn *lua.LFunction) func(args ...any) (any, error) {
+	return func(args ...any) (any, error) {
+		luaArgs := make([]lua.LValue, len(args))
+		for i, arg := range args {
+			luaArgs[i] = goValueToLua(L, arg)
+		}
+		if err := L.CallByParam(lua.P{Fn: fn, NRet: 1, Protect: true}, luaArgs...); err != nil {
+			return nil, err
+		}
+		result := L.Get(-1)
+		L.Pop(1)
+		return luaValueToGo(result), nil
+	}
+}
+
+func registerRenderModule(L *lua.LState, rs *templateState) {
+	mod := L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"template":  rs.renderTemplateLua,
+		"html":      rs.renderHTMLLua,
+		"filter":    rs.registerFilter,
+		"on_render": rs.registerHook,
+	})
+	L.SetGlobal("render", mod)
+}
+
+func (rs *templateState) registerFilter(L *lua.LState) int {
+	name := L.CheckString(1)
+	fn := L.CheckFunction(2)
+	rs.filters[name] = fn
+	return 0
+}
+
+// registerHook implements render.on_render(name, fn): fn is invoked with
+// the data table just before name is executed, and is expected to mutate it
+// in place, since Lua tables are reference values.
+func (rs *templateState) registerHook(L *lua.LState) int {
+	name := L.CheckString(1)
+	fn := L.CheckFunction(2)
+	rs.hooks[name] = append(rs.hooks[name], fn)
+	return 0
+}
+
+func (rs *templateState) renderTemplateLua(L *lua.LState) int {
+	name := L.CheckString(1)
+	data := L.OptTable(2, L.NewTable())
+	body, err := rs.render(L, name, data)
+	if err != nil {
+		L.RaiseError("render.template %q: %v", name, err)
+		return 0
+	}
+	L.Push(lua.LString(body))
+	return 1
+}
+
+// renderHTMLLua implements render.html(status, name, data): a convenience
+// that renders name and returns it already shaped as a handler's (status,
+// body, headers) triple, tagging body as renderedHTML so attachRoute knows
+// to write it as HTML rather than JSON-encode it.
+func (rs *templateState) renderHTMLLua(L *lua.LState) int {
+	status := L.CheckInt(1)
+	name := L.CheckString(2)
+	data := L.OptTable(3, L.NewTable())
+	body, err := rs.render(L, name, data)
+	if err != nil {
+		L.RaiseError("render.html %q: %v", name, err)
+		return 0
+	}
+
+	userData := L.NewUserData()
+	userData.Value = renderedHTML(body)
+
+	L.Push(lua.LNumber(status))
+	L.Push(userData)
+	L.Push(L.NewTable())
+	return 3
+}
+
+// render runs name's on_render hooks before executing the template against
+// data's Go equivalent.
+func (rs *templateState) render(L *lua.LState, name string, data *lua.LTable) (string, error) {
+	if rs.tmpl == nil {
+		return "", fmt.Errorf("no templates loaded")
+	}
+	for _, hook := range rs.hooks[name] {
+		if err := L.CallByParam(lua.P{Fn: hook, NRet: 0, Protect: true}, data); err != nil {
+			return "", err
+		}
+	}
+
+	var out strings.Builder
+	if err := rs.tmpl.ExecuteTemplate(&out, name, luaTableToMap(data)); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
@@ -3,6 +3,7 @@ package server
 import (
 	"github.com/gin-gonic/gin"
 
+	"lunar-lander/internal/db"
 	"lunar-lander/internal/sugardb"
 )
 
@@ -11,12 +12,15 @@ type Runtime struct {
 	Engine *LuaEngine
 }
 
-func BuildRuntime(scriptPath string, store *sugardb.Store) (*Runtime, error) {
+func BuildRuntime(scriptPath string, store *sugardb.Store, records *db.Store, opts EngineOptions) (*Runtime, error) {
 	router := gin.New()
 	router.Use(gin.Recovery())
 
-	engine := NewLuaEngine(router, store)
-	if err := engine.LoadScript(scriptPath); err != nil {
+	engine, err := NewLuaEngine(router, store, records, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := engine.LoadScript(scriptPath, opts.LuaPoolSize); err != nil {
 		engine.Close()
 		return nil, err
 	}
@@ -0,0 +1,249 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yuin/gopher-lua"
+)
+
+// rpcMethod is one typed method declared via rpc.service in Lua.
+type rpcMethod struct {
+	name           string
+	requestSchema  map[string]string
+	responseSchema map[string]string
+	handler        *lua.LFunction
+}
+
+// rpcService is a named collection of rpcMethods, routed under
+// /twirp/<Service>/<Method>.
+type rpcService struct {
+	name    string
+	methods []*rpcMethod
+}
+
+func registerRPCModule(L *lua.LState, engine *LuaEngine) {
+	mod := L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"service": engine.rpcDeclareService,
+	})
+	L.SetGlobal("rpc", mod)
+	engine.route.GET("/twirp/manifest", engine.twirpManifest)
+}
+
+// rpcDeclareService implements rpc.service(name, methods), registering one
+// POST route per declared method.
+func (e *LuaEngine) rpcDeclareService(L *lua.LState) int {
+	name := L.CheckString(1)
+	methodsTable := L.CheckTable(2)
+
+	svc := &rpcService{name: name}
+
+	var declErr error
+	methodsTable.ForEach(func(key, value lua.LValue) {
+		if declErr != nil {
+			return
+		}
+		methodTable, ok := value.(*lua.LTable)
+		if !ok {
+			declErr = fmt.Errorf("rpc.service: method %q must be a table", key.String())
+			return
+		}
+		method := &rpcMethod{name: key.String()}
+		method.requestSchema = schemaFromTable(methodTable.RawGetString("request"))
+		method.responseSchema = schemaFromTable(methodTable.RawGetString("response"))
+		handler, ok := methodTable.RawGetString("handler").(*lua.LFunction)
+		if !ok {
+			declErr = fmt.Errorf("rpc.service: method %q is missing a handler function", key.String())
+			return
+		}
+		method.handler = handler
+		svc.methods = append(svc.methods, method)
+	})
+	if declErr != nil {
+		L.RaiseError("%v", declErr)
+		return 0
+	}
+
+	e.rpcServices = append(e.rpcServices, svc)
+	for _, method := range svc.methods {
+		path := fmt.Sprintf("/twirp/%s/%s", svc.name, method.name)
+		e.route.POST(path, e.rpcHandler(method))
+	}
+	return 0
+}
+
+func schemaFromTable(value lua.LValue) map[string]string {
+	schema := map[string]string{}
+	table, ok := value.(*lua.LTable)
+	if !ok {
+		return schema
+	}
+	table.ForEach(func(key, value lua.LValue) {
+		schema[key.String()] = value.String()
+	})
+	return schema
+}
+
+// rpcHandler builds the gin.HandlerFunc for one typed RPC method: decode the
+// JSON body, validate/coerce it against the request schema, invoke the Lua
+// handler, then validate/coerce its return value against the response
+// schema.
+func (e *LuaEngine) rpcHandler(method *rpcMethod) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		payload := map[string]any{}
+		dec := json.NewDecoder(c.Request.Body)
+		dec.UseNumber()
+		if err := dec.Decode(&payload); err != nil && err != io.EOF {
+			writeTwirpError(c, http.StatusBadRequest, "invalid_argument", "invalid JSON body: "+err.Error())
+			return
+		}
+
+		request, err := coerceSchema(payload, method.requestSchema)
+		if err != nil {
+			writeTwirpError(c, http.StatusBadRequest, "invalid_argument", err.Error())
+			return
+		}
+
+		e.mu.Lock()
+		defer e.mu.Unlock()
+
+		if err := e.L.CallByParam(lua.P{Fn: method.handler, NRet: 1, Protect: true}, goValueToLua(e.L, request)); err != nil {
+			writeTwirpError(c, http.StatusInternalServerError, "internal", err.Error())
+			return
+		}
+		result := e.L.Get(-1)
+		e.L.Pop(1)
+
+		respTable, ok := result.(*lua.LTable)
+		if !ok {
+			writeTwirpError(c, http.StatusInternalServerError, "internal", "handler did not return a response table")
+			return
+		}
+		response, err := coerceSchema(luaTableToMap(respTable), method.responseSchema)
+		if err != nil {
+			writeTwirpError(c, http.StatusInternalServerError, "internal", "response validation failed: "+err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+func writeTwirpError(c *gin.Context, status int, code, msg string) {
+	c.JSON(status, gin.H{"code": code, "msg": msg})
+}
+
+// coerceSchema validates that every field declared in schema is present in
+// payload and coerces it to the declared type, returning a fresh map so the
+// caller never sees undeclared fields.
+func coerceSchema(payload map[string]any, schema map[string]string) (map[string]any, error) {
+	result := make(map[string]any, len(schema))
+	for field, typeName := range schema {
+		raw, ok := payload[field]
+		if !ok {
+			return nil, fmt.Errorf("missing required field %q", field)
+		}
+		coerced, err := coerceValue(raw, typeName)
+		if err != nil {
+			return nil, fmt.Errorf("field %q: %w", field, err)
+		}
+		result[field] = coerced
+	}
+	return result, nil
+}
+
+func coerceValue(value any, typeName string) (any, error) {
+	switch typeName {
+	case "string":
+		switch v := value.(type) {
+		case string:
+			return v, nil
+		case json.Number:
+			return v.String(), nil
+		case bool:
+			return strconv.FormatBool(v), nil
+		default:
+			return nil, fmt.Errorf("expected string, got %T", value)
+		}
+	case "int":
+		switch v := value.(type) {
+		case json.Number:
+			i, err := v.Int64()
+			if err != nil {
+				return nil, fmt.Errorf("expected int, got %q", v.String())
+			}
+			return int(i), nil
+		case string:
+			i, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, fmt.Errorf("expected int, got %q", v)
+			}
+			return i, nil
+		default:
+			return nil, fmt.Errorf("expected int, got %T", value)
+		}
+	case "float":
+		switch v := value.(type) {
+		case json.Number:
+			f, err := v.Float64()
+			if err != nil {
+				return nil, fmt.Errorf("expected float, got %q", v.String())
+			}
+			return f, nil
+		case string:
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, fmt.Errorf("expected float, got %q", v)
+			}
+			return f, nil
+		default:
+			return nil, fmt.Errorf("expected float, got %T", value)
+		}
+	case "bool":
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("expected bool, got %q", v)
+			}
+			return b, nil
+		default:
+			return nil, fmt.Errorf("expected bool, got %T", value)
+		}
+	default:
+		return value, nil
+	}
+}
+
+// twirpManifest serves a machine-readable description of every declared
+// service so external clients can codegen against it.
+func (e *LuaEngine) twirpManifest(c *gin.Context) {
+	type methodDescriptor struct {
+		Name     string            `json:"name"`
+		Request  map[string]string `json:"request"`
+		Response map[string]string `json:"response"`
+	}
+	type serviceDescriptor struct {
+		Name    string             `json:"name"`
+		Methods []methodDescriptor `json:"methods"`
+	}
+
+	descriptors := make([]serviceDescriptor, 0, len(e.rpcServices))
+	for _, svc := range e.rpcServices {
+		sd := serviceDescriptor{Name: svc.name}
+		for _, method := range svc.methods {
+			sd.Methods = append(sd.Methods, methodDescriptor{
+				Name:     method.name,
+				Request:  method.requestSchema,
+				Response: method.responseSchema,
+			})
+		}
+		descriptors = append(descriptors, sd)
+	}
+	c.JSON(http.StatusOK, gin.H{"services": descriptors})
+}
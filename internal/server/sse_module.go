@@ -0,0 +1,129 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yuin/gopher-lua"
+)
+
+const sseHeartbeatInterval = 15 * time.Second
+
+// registerSSE implements rest.sse(path, handler). Each connection checks
+// out its own replica Lua state from the pool for as long as it stays open,
+// so one long-lived stream never blocks unrelated requests the way
+// serializing through the shared loader state would. The handler is
+// invoked once with a stream table exposing send(event, data) and
+// closed(); the connection stays open for as long as handler keeps running
+// (e.g. looping on a sugardb.subscribe() handle) or until the client
+// disconnects. prefix is prepended to path, matching get/post/etc., so
+// rest.sse registered inside a rest.group is actually scoped under that
+// group.
+func (e *LuaEngine) registerSSE(prefix string) lua.LGFunction {
+	return func(L *lua.LState) int {
+		path := prefix + L.CheckString(1)
+		handler := L.CheckFunction(2)
+		authSpec := routeAuthSpecFromOpts(L, 3)
+		e.refs = append(e.refs, handler)
+		id := routeID("SSE", path)
+
+		e.route.GET(path, func(c *gin.Context) {
+			if authSpec != nil && !e.authorize(authSpec, c) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+				return
+			}
+
+			checkoutCtx, cancelCheckout := context.WithTimeout(c.Request.Context(), e.handlerTimeout)
+			entry, ok := e.checkoutState(checkoutCtx)
+			cancelCheckout()
+			if !ok {
+				c.JSON(http.StatusServiceUnavailable, gin.H{"error": "lua state pool exhausted", "code": "pool_checkout_timeout"})
+				return
+			}
+
+			poolHandler, ok := entry.handlers[id]
+			if !ok {
+				e.releaseState(entry)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "handler missing from Lua state pool"})
+				return
+			}
+
+			flusher, ok := c.Writer.(http.Flusher)
+			if !ok {
+				e.releaseState(entry)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "streaming not supported"})
+				return
+			}
+
+			c.Header("Content-Type", "text/event-stream")
+			c.Header("Cache-Control", "no-cache")
+			c.Header("Connection", "keep-alive")
+			c.Writer.WriteHeader(http.StatusOK)
+			flusher.Flush()
+
+			stop := make(chan struct{})
+			defer close(stop)
+			go sseHeartbeat(c, flusher, stop)
+
+			// Replace any context left on the replica by an earlier rest.*
+			// request, which may already be cancelled.
+			entry.L.SetContext(c.Request.Context())
+			err := entry.L.CallByParam(lua.P{Fn: poolHandler, NRet: 0, Protect: true}, sseStreamTable(entry.L, c, flusher))
+			e.releaseState(entry)
+			if err != nil {
+				lg := requestLogger(newRequestID())
+				lg.Error().Err(err).Str("path", path).Msg("sse handler failed")
+			}
+		})
+		return 0
+	}
+}
+
+// sseHeartbeat periodically writes a comment line to keep idle connections
+// from being reaped by proxies, stopping as soon as the client disconnects
+// or the handler returns.
+func sseHeartbeat(c *gin.Context, flusher http.Flusher, stop <-chan struct{}) {
+	ticker := time.NewTicker(sseHeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := fmt.Fprint(c.Writer, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-c.Request.Context().Done():
+			return
+		case <-stop:
+			return
+		}
+	}
+}
+
+func sseStreamTable(L *lua.LState, c *gin.Context, flusher http.Flusher) *lua.LTable {
+	table := L.NewTable()
+	table.RawSetString("send", L.NewFunction(func(L *lua.LState) int {
+		event := L.CheckString(1)
+		data := L.CheckString(2)
+		if _, err := fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", event, data); err != nil {
+			L.Push(lua.LFalse)
+			return 1
+		}
+		flusher.Flush()
+		L.Push(lua.LTrue)
+		return 1
+	}))
+	table.RawSetString("closed", L.NewFunction(func(L *lua.LState) int {
+		select {
+		case <-c.Request.Context().Done():
+			L.Push(lua.LTrue)
+		default:
+			L.Push(lua.LFalse)
+		}
+		return 1
+	}))
+	return table
+}
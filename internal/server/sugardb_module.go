@@ -2,6 +2,7 @@ package server
 
 import (
 	"sort"
+	"time"
 
 	"github.com/yuin/gopher-lua"
 
@@ -13,10 +14,16 @@ func registerSugarDBModule(L *lua.LState, store *sugardb.Store) {
 		store = sugardb.NewStore()
 	}
 	mod := L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
-		"get":    sugarGet(store),
-		"set":    sugarSet(store),
-		"delete": sugarDelete(store),
-		"keys":   sugarKeys(store),
+		"get":       sugarGet(store),
+		"set":       sugarSet(store),
+		"delete":    sugarDelete(store),
+		"keys":      sugarKeys(store),
+		"expire":    sugarExpire(store),
+		"ttl":       sugarTTL(store),
+		"incr":      sugarIncr(store),
+		"setnx":     sugarSetNX(store),
+		"publish":   sugarPublish(store),
+		"subscribe": sugarSubscribe(store),
 	})
 	L.SetGlobal("sugardb", mod)
 }
@@ -34,16 +41,73 @@ func sugarGet(store *sugardb.Store) lua.LGFunction {
 	}
 }
 
+// sugarSet implements sugardb.set(key, value, ttl_seconds?); omitting
+// ttl_seconds preserves the original no-expiry semantics.
 func sugarSet(store *sugardb.Store) lua.LGFunction {
 	return func(L *lua.LState) int {
 		key := L.CheckString(1)
 		value := L.CheckAny(2)
-		store.Set(key, luaValueToGo(value))
+		var ttl time.Duration
+		if L.GetTop() >= 3 {
+			if seconds, ok := L.Get(3).(lua.LNumber); ok {
+				ttl = time.Duration(float64(seconds) * float64(time.Second))
+			}
+		}
+		store.Set(key, luaValueToGo(value), ttl)
 		L.Push(lua.LTrue)
 		return 1
 	}
 }
 
+func sugarExpire(store *sugardb.Store) lua.LGFunction {
+	return func(L *lua.LState) int {
+		key := L.CheckString(1)
+		seconds := L.CheckNumber(2)
+		ttl := time.Duration(float64(seconds) * float64(time.Second))
+		L.Push(lua.LBool(store.Expire(key, ttl)))
+		return 1
+	}
+}
+
+func sugarTTL(store *sugardb.Store) lua.LGFunction {
+	return func(L *lua.LState) int {
+		key := L.CheckString(1)
+		ttl, ok := store.TTL(key)
+		if !ok {
+			L.Push(lua.LNil)
+			return 1
+		}
+		L.Push(lua.LNumber(ttl.Seconds()))
+		return 1
+	}
+}
+
+func sugarIncr(store *sugardb.Store) lua.LGFunction {
+	return func(L *lua.LState) int {
+		key := L.CheckString(1)
+		delta := 1.0
+		if L.GetTop() >= 2 {
+			delta = float64(L.CheckNumber(2))
+		}
+		result, err := store.Incr(key, delta)
+		if err != nil {
+			L.RaiseError("sugardb.incr: %v", err)
+			return 0
+		}
+		L.Push(lua.LNumber(result))
+		return 1
+	}
+}
+
+func sugarSetNX(store *sugardb.Store) lua.LGFunction {
+	return func(L *lua.LState) int {
+		key := L.CheckString(1)
+		value := L.CheckAny(2)
+		L.Push(lua.LBool(store.SetNX(key, luaValueToGo(value))))
+		return 1
+	}
+}
+
 func sugarDelete(store *sugardb.Store) lua.LGFunction {
 	return func(L *lua.LState) int {
 		key := L.CheckString(1)
@@ -52,6 +116,68 @@ func sugarDelete(store *sugardb.Store) lua.LGFunction {
 	}
 }
 
+// sugarPublish implements sugardb.publish(channel, message), fanning the
+// message out to every live subscribe() handle on that channel.
+func sugarPublish(store *sugardb.Store) lua.LGFunction {
+	return func(L *lua.LState) int {
+		channel := L.CheckString(1)
+		message := L.CheckAny(2)
+		store.Publish(channel, luaValueToGo(message))
+		return 0
+	}
+}
+
+// sugarSubscribe implements sugardb.subscribe(channel), returning a handle
+// with recv(timeout_seconds?) and close(). recv blocks for a new message,
+// returning nil if timeout_seconds elapses first (or immediately, with no
+// argument, if the handle has been closed); close() stops delivery and lets
+// the underlying channel be garbage collected.
+func sugarSubscribe(store *sugardb.Store) lua.LGFunction {
+	return func(L *lua.LState) int {
+		channel := L.CheckString(1)
+		ch := store.Subscribe(channel)
+
+		closed := false
+		handle := L.NewTable()
+		handle.RawSetString("recv", L.NewFunction(func(L *lua.LState) int {
+			if closed {
+				L.Push(lua.LNil)
+				return 1
+			}
+			if L.GetTop() >= 1 {
+				seconds := L.CheckNumber(1)
+				timeout := time.Duration(float64(seconds) * float64(time.Second))
+				select {
+				case msg, ok := <-ch:
+					if !ok {
+						L.Push(lua.LNil)
+						return 1
+					}
+					L.Push(goValueToLua(L, msg))
+					return 1
+				case <-time.After(timeout):
+					L.Push(lua.LNil)
+					return 1
+				}
+			}
+			msg, ok := <-ch
+			if !ok {
+				L.Push(lua.LNil)
+				return 1
+			}
+			L.Push(goValueToLua(L, msg))
+			return 1
+		}))
+		handle.RawSetString("close", L.NewFunction(func(L *lua.LState) int {
+			closed = true
+			store.Unsubscribe(channel, ch)
+			return 0
+		}))
+		L.Push(handle)
+		return 1
+	}
+}
+
 func sugarKeys(store *sugardb.Store) lua.LGFunction {
 	return func(L *lua.LState) int {
 		keys := store.Keys()
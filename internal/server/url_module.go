@@ -0,0 +1,125 @@
+package server
+
+import (
+	"net/url"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// registerURLModule exposes url.parse/build/build_query_string/resolve,
+// matching gluaurl's surface, since that's the de facto standard shape for
+// URL helpers in gopher-lua scripts. Stateless, so the loader and every
+// pool replica (see lua_pool.go) just call this once each.
+func registerURLModule(L *lua.LState) {
+	mod := L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"parse":              urlParse,
+		"build":              urlBuild,
+		"build_query_string": urlBuildQueryString,
+		"resolve":            urlResolve,
+	})
+	L.SetGlobal("url", mod)
+}
+
+func urlParse(L *lua.LState) int {
+	parsed, err := url.Parse(L.CheckString(1))
+	if err != nil {
+		L.RaiseError("url.parse: %v", err)
+		return 0
+	}
+	L.Push(urlToTable(L, parsed))
+	return 1
+}
+
+func urlToTable(L *lua.LState, parsed *url.URL) *lua.LTable {
+	table := L.NewTable()
+	table.RawSetString("scheme", lua.LString(parsed.Scheme))
+	table.RawSetString("host", lua.LString(parsed.Hostname()))
+	table.RawSetString("port", lua.LString(parsed.Port()))
+	table.RawSetString("path", lua.LString(parsed.Path))
+	table.RawSetString("raw_query", lua.LString(parsed.RawQuery))
+	table.RawSetString("fragment", lua.LString(parsed.Fragment))
+	if parsed.User != nil {
+		table.RawSetString("username", lua.LString(parsed.User.Username()))
+		if password, ok := parsed.User.Password(); ok {
+			table.RawSetString("password", lua.LString(password))
+		}
+	}
+
+	query := L.NewTable()
+	for key, values := range parsed.Query() {
+		if len(values) == 1 {
+			query.RawSetString(key, lua.LString(values[0]))
+			continue
+		}
+		list := L.NewTable()
+		for i, v := range values {
+			list.RawSetInt(i+1, lua.LString(v))
+		}
+		query.RawSetString(key, list)
+	}
+	table.RawSetString("query", query)
+
+	return table
+}
+
+func urlBuild(L *lua.LState) int {
+	table := L.CheckTable(1)
+	built := &url.URL{
+		Scheme:   tableRawString(table, "scheme"),
+		Host:     tableRawString(table, "host"),
+		Path:     tableRawString(table, "path"),
+		RawQuery: tableRawString(table, "raw_query"),
+		Fragment: tableRawString(table, "fragment"),
+	}
+	if port := tableRawString(table, "port"); port != "" {
+		built.Host = built.Host + ":" + port
+	}
+	if username := tableRawString(table, "username"); username != "" {
+		if password := tableRawString(table, "password"); password != "" {
+			built.User = url.UserPassword(username, password)
+		} else {
+			built.User = url.User(username)
+		}
+	}
+	if query, ok := table.RawGetString("query").(*lua.LTable); ok {
+		values := url.Values{}
+		query.ForEach(func(key, value lua.LValue) {
+			values.Set(key.String(), value.String())
+		})
+		built.RawQuery = values.Encode()
+	}
+	L.Push(lua.LString(built.String()))
+	return 1
+}
+
+func tableRawString(table *lua.LTable, key string) string {
+	if v, ok := table.RawGetString(key).(lua.LString); ok {
+		return string(v)
+	}
+	return ""
+}
+
+func urlBuildQueryString(L *lua.LState) int {
+	table := L.CheckTable(1)
+	values := url.Values{}
+	table.ForEach(func(key, value lua.LValue) {
+		values.Set(key.String(), value.String())
+	})
+	L.Push(lua.LString(values.Encode()))
+	return 1
+}
+
+func urlResolve(L *lua.LState) int {
+	base, err := url.Parse(L.CheckString(1))
+	if err != nil {
+		L.RaiseError("url.resolve: %v", err)
+		return 0
+	}
+	ref, err := url.Parse(L.CheckString(2))
+	if err != nil {
+		L.RaiseError("url.resolve: %v", err)
+		return 0
+	}
+	L.Push(lua.LString(base.ResolveReference(ref).String()))
+	return 1
+}
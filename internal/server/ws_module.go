@@ -0,0 +1,194 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/yuin/gopher-lua"
+)
+
+var wsUpgrader = websocket.Upgrader{
+	// Scripts are responsible for their own origin checks (e.g. via
+	// request.headers when the route also carries an auth spec).
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// wsConnection backs the connection table passed to a rest.websocket
+// handler. It owns a replica Lua state checked out of the engine's pool for
+// the connection's whole lifetime, so a long-lived connection never
+// contends with other requests for the loader state. Reads are multiplexed
+// on a dedicated goroutine; each message is buffered for recv() and, once
+// on_message is registered, also passed to it; luaMu serializes those two
+// call sites against each other,
+// since entry.L itself can't be called from two goroutines at once.
+type wsConnection struct {
+	conn  *websocket.Conn
+	entry *poolEntry
+	inbox chan []byte
+	done  chan struct{}
+
+	luaMu     sync.Mutex
+	closeOnce sync.Once
+	onMessage *lua.LFunction
+}
+
+// registerWebSocket implements rest.websocket(path, handler). Each
+// connection checks out its own replica Lua state from the pool for as long
+// as it stays open, so one long-lived websocket never blocks unrelated
+// requests the way serializing through the shared loader state would. The
+// connection table exposes send(msg), recv(timeout_seconds?), close() and
+// on_message(fn). prefix is prepended to path, matching get/post/etc., so
+// rest.websocket registered inside a rest.group is actually scoped under
+// that group.
+func (e *LuaEngine) registerWebSocket(prefix string) lua.LGFunction {
+	return func(L *lua.LState) int {
+		path := prefix + L.CheckString(1)
+		handler := L.CheckFunction(2)
+		authSpec := routeAuthSpecFromOpts(L, 3)
+		e.refs = append(e.refs, handler)
+		id := routeID("WS", path)
+
+		e.route.GET(path, func(c *gin.Context) {
+			if authSpec != nil && !e.authorize(authSpec, c) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+				return
+			}
+
+			checkoutCtx, cancelCheckout := context.WithTimeout(c.Request.Context(), e.handlerTimeout)
+			entry, ok := e.checkoutState(checkoutCtx)
+			cancelCheckout()
+			if !ok {
+				c.JSON(http.StatusServiceUnavailable, gin.H{"error": "lua state pool exhausted", "code": "pool_checkout_timeout"})
+				return
+			}
+
+			poolHandler, ok := entry.handlers[id]
+			if !ok {
+				e.releaseState(entry)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "handler missing from Lua state pool"})
+				return
+			}
+
+			conn, err := wsUpgrader.Upgrade(c.Writer, c.Request, nil)
+			if err != nil {
+				e.releaseState(entry)
+				return
+			}
+
+			wsConn := &wsConnection{conn: conn, entry: entry, inbox: make(chan []byte, 16), done: make(chan struct{})}
+			go wsConn.readLoop()
+
+			wsConn.luaMu.Lock()
+			// Replace any context left on the replica by an earlier rest.*
+			// request, which may already be cancelled.
+			entry.L.SetContext(c.Request.Context())
+			err = entry.L.CallByParam(lua.P{Fn: poolHandler, NRet: 0, Protect: true}, wsConn.luaTable(entry.L))
+			wsConn.luaMu.Unlock()
+			if err != nil {
+				lg := requestLogger(newRequestID())
+				lg.Error().Err(err).Str("path", path).Msg("websocket handler failed")
+			}
+
+			wsConn.Close()
+			<-wsConn.done
+			e.releaseState(entry)
+		})
+		return 0
+	}
+}
+
+// readLoop owns the socket's read side for its whole lifetime, independent
+// of any single Lua call.
+func (w *wsConnection) readLoop() {
+	defer close(w.done)
+	defer w.Close()
+	defer close(w.inbox)
+	for {
+		_, data, err := w.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		select {
+		case w.inbox <- data:
+		default:
+			// Drop the message rather than block the reader when the recv()
+			// buffer is full.
+		}
+		if w.onMessage != nil {
+			w.luaMu.Lock()
+			_ = w.entry.L.CallByParam(lua.P{Fn: w.onMessage, NRet: 0, Protect: true}, lua.LString(string(data)))
+			w.luaMu.Unlock()
+		}
+	}
+}
+
+func (w *wsConnection) Close() {
+	w.closeOnce.Do(func() { _ = w.conn.Close() })
+}
+
+func (w *wsConnection) luaTable(L *lua.LState) *lua.LTable {
+	table := L.NewTable()
+	table.RawSetString("send", L.NewFunction(w.luaSend))
+	table.RawSetString("recv", L.NewFunction(w.luaRecv))
+	table.RawSetString("close", L.NewFunction(func(L *lua.LState) int {
+		w.Close()
+		return 0
+	}))
+	table.RawSetString("on_message", L.NewFunction(func(L *lua.LState) int {
+		w.onMessage = L.CheckFunction(1)
+		return 0
+	}))
+	return table
+}
+
+func (w *wsConnection) luaSend(L *lua.LState) int {
+	var payload []byte
+	switch msg := L.CheckAny(1).(type) {
+	case lua.LString:
+		payload = []byte(string(msg))
+	default:
+		encoded, err := json.Marshal(luaValueToGo(msg))
+		if err != nil {
+			L.Push(lua.LFalse)
+			return 1
+		}
+		payload = encoded
+	}
+	if err := w.conn.WriteMessage(websocket.TextMessage, payload); err != nil {
+		L.Push(lua.LFalse)
+		return 1
+	}
+	L.Push(lua.LTrue)
+	return 1
+}
+
+func (w *wsConnection) luaRecv(L *lua.LState) int {
+	if L.GetTop() >= 1 {
+		seconds := L.CheckNumber(1)
+		timeout := time.Duration(float64(seconds) * float64(time.Second))
+		select {
+		case data, ok := <-w.inbox:
+			if !ok {
+				L.Push(lua.LNil)
+				return 1
+			}
+			L.Push(lua.LString(string(data)))
+			return 1
+		case <-time.After(timeout):
+			L.Push(lua.LNil)
+			return 1
+		}
+	}
+	data, ok := <-w.inbox
+	if !ok {
+		L.Push(lua.LNil)
+		return 1
+	}
+	L.Push(lua.LString(string(data)))
+	return 1
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/yuin/gopher-lua"
+	"gopkg.in/yaml.v3"
+)
+
+// registerYAMLModule exposes yaml.encode/decode, sharing the same
+// Go<->Lua conversion as the json module where the shapes overlap.
+// Stateless, so the loader and every pool replica (see lua_pool.go) just
+// call this once each.
+func registerYAMLModule(L *lua.LState) {
+	mod := L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"encode": yamlEncode,
+		"decode": yamlDecode,
+	})
+	L.SetGlobal("yaml", mod)
+}
+
+func yamlEncode(L *lua.LState) int {
+	value := L.CheckAny(1)
+	encoded, err := yaml.Marshal(luaValueToGo(value))
+	if err != nil {
+		L.RaiseError("yaml.encode: %v", err)
+		return 0
+	}
+	L.Push(lua.LString(encoded))
+	return 1
+}
+
+func yamlDecode(L *lua.LState) int {
+	raw := L.CheckString(1)
+	var decoded any
+	if err := yaml.Unmarshal([]byte(raw), &decoded); err != nil {
+		L.RaiseError("yaml.decode: %v", err)
+		return 0
+	}
+	L.Push(yamlValueToLua(L, decoded))
+	return 1
+}
+
+// yamlValueToLua is goValueToLua plus map[string]interface{}/map[any]any,
+// which yaml.Unmarshal produces for mappings instead of the json package's
+// map[string]any.
+func yamlValueToLua(L *lua.LState, value any) lua.LValue {
+	switch typed := value.(type) {
+	case map[string]any:
+		table := L.NewTable()
+		for key, item := range typed {
+			table.RawSetString(key, yamlValueToLua(L, item))
+		}
+		return table
+	case map[any]any:
+		table := L.NewTable()
+		for key, item := range typed {
+			table.RawSetString(fmt.Sprint(key), yamlValueToLua(L, item))
+		}
+		return table
+	case []any:
+		table := L.NewTable()
+		for i, item := range typed {
+			table.RawSetInt(i+1, yamlValueToLua(L, item))
+		}
+		return table
+	default:
+		return goValueToLua(L, value)
+	}
+}
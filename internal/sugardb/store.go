@@ -1,27 +1,259 @@
 package sugardb
 
-import "sync"
+import (
+	"container/heap"
+	"fmt"
+	"sync"
+	"time"
+)
 
+const evictionInterval = time.Second
+
+// entry is a stored value plus its optional expiry. A zero expiresAt means
+// the key never expires.
+type entry struct {
+	value     any
+	expiresAt time.Time
+}
+
+// expiryEntry is one min-heap node keyed by expiry time. Stale nodes (a key
+// whose TTL was since changed) are detected and dropped lazily by the
+// active evictor, which checks each popped node against the current entry.
+type expiryEntry struct {
+	key       string
+	expiresAt time.Time
+}
+
+type expiryQueue []expiryEntry
+
+func (q expiryQueue) Len() int           { return len(q) }
+func (q expiryQueue) Less(i, j int) bool { return q[i].expiresAt.Before(q[j].expiresAt) }
+func (q expiryQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *expiryQueue) Push(x any)        { *q = append(*q, x.(expiryEntry)) }
+func (q *expiryQueue) Pop() any {
+	old := *q
+	n := len(old)
+	last := old[n-1]
+	*q = old[:n-1]
+	return last
+}
+
+// Store is an in-memory key/value cache with per-key TTLs, evicted both
+// lazily (on access) and actively (by a background goroutine).
 type Store struct {
-	mu   sync.RWMutex
-	data map[string]any
+	mu       sync.Mutex
+	data     map[string]entry
+	queue    expiryQueue
+	stopCh   chan struct{}
+	stopOnce sync.Once
+
+	subMu sync.Mutex
+	subs  map[string][]chan any
 }
 
 func NewStore() *Store {
-	return &Store{data: map[string]any{}}
+	s := &Store{
+		data:   map[string]entry{},
+		stopCh: make(chan struct{}),
+		subs:   map[string][]chan any{},
+	}
+	go s.evictLoop()
+	return s
+}
+
+// Subscribe returns a channel that receives every message Published to
+// channel from now on. The caller should Unsubscribe once done to let the
+// channel be garbage collected.
+func (s *Store) Subscribe(channel string) <-chan any {
+	ch := make(chan any, 16)
+	s.subMu.Lock()
+	s.subs[channel] = append(s.subs[channel], ch)
+	s.subMu.Unlock()
+	return ch
 }
 
+// Unsubscribe removes a channel previously returned by Subscribe.
+func (s *Store) Unsubscribe(channel string, ch <-chan any) {
+	s.subMu.Lock()
+	defer s.subMu.Unlock()
+	subs := s.subs[channel]
+	for i, sub := range subs {
+		if sub == ch {
+			s.subs[channel] = append(subs[:i], subs[i+1:]...)
+			return
+		}
+	}
+}
+
+// Publish fans msg out to every current subscriber of channel, dropping it
+// for subscribers whose buffer is full rather than blocking the publisher.
+func (s *Store) Publish(channel string, msg any) {
+	s.subMu.Lock()
+	subs := append([]chan any(nil), s.subs[channel]...)
+	s.subMu.Unlock()
+
+	for _, ch := range subs {
+		select {
+		case ch <- msg:
+		default:
+		}
+	}
+}
+
+// Close stops the background eviction goroutine. It is safe to call more
+// than once.
+func (s *Store) Close() {
+	s.stopOnce.Do(func() { close(s.stopCh) })
+}
+
+func (s *Store) evictLoop() {
+	ticker := time.NewTicker(evictionInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.evictExpired()
+		case <-s.stopCh:
+			return
+		}
+	}
+}
+
+func (s *Store) evictExpired() {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.queue.Len() > 0 && !s.queue[0].expiresAt.After(now) {
+		next := heap.Pop(&s.queue).(expiryEntry)
+		if current, ok := s.data[next.key]; ok && isExpired(current, now) {
+			delete(s.data, next.key)
+		}
+	}
+}
+
+func isExpired(e entry, now time.Time) bool {
+	return !e.expiresAt.IsZero() && !e.expiresAt.After(now)
+}
+
+// Get returns the value for key, lazily evicting it first if its TTL has
+// passed.
 func (s *Store) Get(key string) (any, bool) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	value, ok := s.data[key]
-	return value, ok
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.data[key]
+	if !ok {
+		return nil, false
+	}
+	if isExpired(e, time.Now()) {
+		delete(s.data, key)
+		return nil, false
+	}
+	return e.value, true
 }
 
-func (s *Store) Set(key string, value any) {
+// Set stores value under key. A ttl of 0 means no expiry, preserving the
+// original Set semantics.
+func (s *Store) Set(key string, value any, ttl time.Duration) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.data[key] = value
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl)
+		heap.Push(&s.queue, expiryEntry{key: key, expiresAt: expiresAt})
+	}
+	s.data[key] = entry{value: value, expiresAt: expiresAt}
+}
+
+// SetNX stores value under key only if key is absent or expired, reporting
+// whether the set happened.
+func (s *Store) SetNX(key string, value any) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.data[key]; ok && !isExpired(e, time.Now()) {
+		return false
+	}
+	s.data[key] = entry{value: value}
+	return true
+}
+
+// Incr atomically adds delta to the numeric value stored at key (treating an
+// absent or expired key as 0) and returns the result.
+func (s *Store) Incr(key string, delta float64) (float64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.data[key]
+	if ok && isExpired(e, time.Now()) {
+		delete(s.data, key)
+		ok = false
+	}
+	current := 0.0
+	expiresAt := time.Time{}
+	if ok {
+		numeric, isNumber := toFloat(e.value)
+		if !isNumber {
+			return 0, fmt.Errorf("sugardb: value for %q is not numeric", key)
+		}
+		current = numeric
+		expiresAt = e.expiresAt
+	}
+	next := current + delta
+	s.data[key] = entry{value: next, expiresAt: expiresAt}
+	return next, nil
+}
+
+func toFloat(value any) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
+
+// Expire sets (or, with a zero ttl, clears) the TTL on an existing key,
+// reporting whether the key was present.
+func (s *Store) Expire(key string, ttl time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.data[key]
+	if !ok || isExpired(e, time.Now()) {
+		delete(s.data, key)
+		return false
+	}
+	if ttl > 0 {
+		e.expiresAt = time.Now().Add(ttl)
+		heap.Push(&s.queue, expiryEntry{key: key, expiresAt: e.expiresAt})
+	} else {
+		e.expiresAt = time.Time{}
+	}
+	s.data[key] = e
+	return true
+}
+
+// TTL returns the remaining time-to-live for key, -1 if the key exists but
+// never expires, or ok=false if the key is absent or already expired.
+func (s *Store) TTL(key string) (time.Duration, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.data[key]
+	if !ok {
+		return 0, false
+	}
+	now := time.Now()
+	if isExpired(e, now) {
+		delete(s.data, key)
+		return 0, false
+	}
+	if e.expiresAt.IsZero() {
+		return -1, true
+	}
+	return e.expiresAt.Sub(now), true
 }
 
 func (s *Store) Delete(key string) bool {
@@ -35,10 +267,15 @@ func (s *Store) Delete(key string) bool {
 }
 
 func (s *Store) Keys() []string {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
 	keys := make([]string, 0, len(s.data))
-	for key := range s.data {
+	for key, e := range s.data {
+		if isExpired(e, now) {
+			delete(s.data, key)
+			continue
+		}
 		keys = append(keys, key)
 	}
 	return keys
@@ -3,16 +3,23 @@ package watch
 import (
 	"context"
 	"fmt"
+	"io/fs"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
 )
 
+// ScriptWatcher watches either a single script file or, for projects that
+// split their script across multiple files via require(), every .lua file
+// under a directory, and calls onChange (debounced) whenever something
+// relevant changes.
 type ScriptWatcher struct {
-	path     string
-	debounce time.Duration
-	onChange func()
+	path       string
+	scriptsDir string
+	debounce   time.Duration
+	onChange   func()
 }
 
 func NewScriptWatcher(path string, onChange func()) *ScriptWatcher {
@@ -27,6 +34,20 @@ func NewScriptWatcher(path string, onChange func()) *ScriptWatcher {
 	}
 }
 
+// NewDirScriptWatcher watches every .lua file under scriptsDir, recursively,
+// instead of a single entry script.
+func NewDirScriptWatcher(scriptsDir string, onChange func()) *ScriptWatcher {
+	absDir, err := filepath.Abs(scriptsDir)
+	if err != nil {
+		absDir = scriptsDir
+	}
+	return &ScriptWatcher{
+		scriptsDir: filepath.Clean(absDir),
+		debounce:   200 * time.Millisecond,
+		onChange:   onChange,
+	}
+}
+
 func (s *ScriptWatcher) Run(ctx context.Context) error {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
@@ -34,8 +55,20 @@ func (s *ScriptWatcher) Run(ctx context.Context) error {
 	}
 	defer watcher.Close()
 
-	dir := filepath.Dir(s.path)
-	if err := watcher.Add(dir); err != nil {
+	if s.scriptsDir != "" {
+		err = filepath.WalkDir(s.scriptsDir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return watcher.Add(path)
+			}
+			return nil
+		})
+	} else {
+		err = watcher.Add(filepath.Dir(s.path))
+	}
+	if err != nil {
 		return fmt.Errorf("watch directory: %w", err)
 	}
 
@@ -52,7 +85,7 @@ func (s *ScriptWatcher) Run(ctx context.Context) error {
 	for {
 		select {
 		case event := <-watcher.Events:
-			if event.Name != s.path {
+			if !s.matches(event.Name) {
 				continue
 			}
 			if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) == 0 {
@@ -84,3 +117,13 @@ func (s *ScriptWatcher) Run(ctx context.Context) error {
 		}
 	}
 }
+
+// matches reports whether a changed path is relevant: any .lua file
+// anywhere under scriptsDir in multi-file mode, or an exact match of the
+// single entry script otherwise.
+func (s *ScriptWatcher) matches(name string) bool {
+	if s.scriptsDir != "" {
+		return strings.HasSuffix(name, ".lua")
+	}
+	return name == s.path
+}